@@ -0,0 +1,83 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gowebp
+
+import (
+	"image"
+	"image/color"
+	"io"
+	"io/ioutil"
+)
+
+// Animation represents the frames of a (possibly animated) WEBP image, as
+// returned by DecodeAll. It is modeled on image/gif.GIF.
+type Animation struct {
+	Image []*image.RGBA // The fully composited frames, each the size of the canvas.
+	Delay []int         // The successive delay times, one per frame, in milliseconds.
+	// LoopCount controls the number of times an animation will be
+	// played. 0 means to loop forever.
+	LoopCount int
+	// BackgroundColor is the canvas background color hint of the ANIM chunk.
+	BackgroundColor color.NRGBA
+	// Config is the global color model and canvas dimensions.
+	Config image.Config
+}
+
+// DecodeAnimation decodes every frame of a WEBP image. A still image is
+// returned as an animation with a single frame. Of opt, only the size limits
+// and UseThreads apply, as libwebp composites the frames. A nil opt means no
+// limits, with threads.
+func DecodeAnimation(data []byte, opt *DecodeOptions) (anim *Animation, err error) {
+	frames, timestamps, w, h, loopCount, bgcolor, err := webpDecodeAnimation(data, opt)
+	if err != nil {
+		return
+	}
+
+	anim = &Animation{
+		Image:     make([]*image.RGBA, len(frames)),
+		Delay:     make([]int, len(frames)),
+		LoopCount: loopCount,
+		BackgroundColor: color.NRGBA{
+			R: uint8(bgcolor >> 16),
+			G: uint8(bgcolor >> 8),
+			B: uint8(bgcolor >> 0),
+			A: uint8(bgcolor >> 24),
+		},
+		Config: image.Config{
+			ColorModel: color.RGBAModel,
+			Width:      w,
+			Height:     h,
+		},
+	}
+
+	// libwebp reports the end timestamp of each frame.
+	var lastTimestamp int
+	for i, pix := range frames {
+		anim.Image[i] = &image.RGBA{
+			Pix:    pix,
+			Stride: 4 * w,
+			Rect:   image.Rect(0, 0, w, h),
+		}
+		anim.Delay[i] = timestamps[i] - lastTimestamp
+		lastTimestamp = timestamps[i]
+	}
+	return
+}
+
+// DecodeAll reads a WEBP image from r and returns the sequential frames and
+// timing information.
+func DecodeAll(r io.Reader) (anim *Animation, err error) {
+	return DecodeAllWithOptions(r, nil)
+}
+
+// DecodeAllWithOptions is like DecodeAll, but decodes with opt, see
+// DecodeAnimation.
+func DecodeAllWithOptions(r io.Reader, opt *DecodeOptions) (anim *Animation, err error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return
+	}
+	return DecodeAnimation(data, opt)
+}
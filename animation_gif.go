@@ -0,0 +1,276 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gowebp
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"sort"
+)
+
+// ToGIFOptions are the options of ToGIF.
+type ToGIFOptions struct {
+	// GlobalPalette quantizes all the frames to a single palette, instead
+	// of one palette per frame.
+	GlobalPalette bool
+	// NumColors is the maximum size of the palettes, 2 ~ 256, including the
+	// transparent color. 0 selects 256.
+	NumColors int
+	// Dither diffuses the quantization error with Floyd-Steinberg.
+	Dither bool
+}
+
+// ToGIF converts the composited frames of anim to a GIF, for the decoders
+// without WEBP support. The colors are quantized by median cut. As GIF has
+// no partial transparency, pixels with an alpha below 50% are transparent
+// and the others are opaque. The delays are rounded to 1/100 s.
+func ToGIF(anim *Animation, opts *ToGIFOptions) (*gif.GIF, error) {
+	if opts == nil {
+		opts = &ToGIFOptions{}
+	}
+	numColors := opts.NumColors
+	if numColors == 0 {
+		numColors = 256
+	}
+	if numColors < 2 || numColors > 256 {
+		return nil, errors.New("webp: ToGIF, NumColors out of range")
+	}
+	if len(anim.Image) == 0 {
+		return nil, errors.New("webp: ToGIF, no frames")
+	}
+
+	frames := make([]*image.NRGBA, len(anim.Image))
+	var transparent bool
+	for i, m := range anim.Image {
+		frames[i] = gifFrameColors(m)
+		transparent = transparent || !frames[i].Opaque()
+	}
+
+	g := &gif.GIF{
+		Image:     make([]*image.Paletted, len(frames)),
+		Delay:     make([]int, len(frames)),
+		Disposal:  make([]byte, len(frames)),
+		LoopCount: gifFromLoopCount(anim.LoopCount),
+		Config: image.Config{
+			Width:  anim.Config.Width,
+			Height: anim.Config.Height,
+		},
+	}
+	var palette color.Palette
+	if opts.GlobalPalette {
+		palette = newGIFPalette(frames, numColors, transparent)
+		g.Config.ColorModel = palette
+		g.BackgroundIndex = uint8(palette.Index(anim.BackgroundColor))
+	}
+	for i, m := range frames {
+		p := palette
+		if p == nil {
+			p = newGIFPalette(frames[i:i+1], numColors, !m.Opaque())
+		}
+		g.Image[i] = gifQuantize(m, p, opts.Dither)
+		g.Delay[i] = (anim.Delay[i] + 5) / 10
+
+		// Each frame is a full canvas, the transparent areas must not
+		// show the frame before.
+		g.Disposal[i] = gif.DisposalNone
+		if transparent {
+			g.Disposal[i] = gif.DisposalBackground
+		}
+	}
+	return g, nil
+}
+
+// gifFromLoopCount returns the GIF loop count of a WEBP loop count: WEBP
+// counts the plays, GIF counts the repetitions after the first one, -1
+// playing once. 0 loops forever in both.
+func gifFromLoopCount(loopCount int) int {
+	switch loopCount {
+	case 0:
+		return 0
+	case 1:
+		return -1
+	default:
+		return loopCount - 1
+	}
+}
+
+// gifFrameColors returns the colors of m with straight alpha, its pixels
+// being either transparent black or opaque.
+func gifFrameColors(m *image.RGBA) *image.NRGBA {
+	b := m.Bounds()
+	dst := image.NewNRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	for y := 0; y < b.Dy(); y++ {
+		src, row := m.Pix[m.PixOffset(b.Min.X, b.Min.Y+y):][:4*b.Dx()], dst.Pix[y*dst.Stride:][:4*b.Dx()]
+		for i := 0; i < len(src); i += 4 {
+			a := uint32(src[i+3])
+			if a < 0x80 {
+				continue
+			}
+			row[i+0] = uint8(uint32(src[i+0]) * 0xff / a)
+			row[i+1] = uint8(uint32(src[i+1]) * 0xff / a)
+			row[i+2] = uint8(uint32(src[i+2]) * 0xff / a)
+			row[i+3] = 0xff
+		}
+	}
+	return dst
+}
+
+// gifColor is an opaque color and its number of pixels.
+type gifColor struct {
+	rgb   [3]uint8
+	count int
+}
+
+// newGIFPalette returns a palette of at most numColors colors for frames,
+// by median cut. The first color is transparent if transparent is set.
+func newGIFPalette(frames []*image.NRGBA, numColors int, transparent bool) color.Palette {
+	var palette color.Palette
+	if transparent {
+		palette = append(palette, color.RGBA{})
+		numColors--
+	}
+
+	counts := make(map[[3]uint8]int)
+	for _, m := range frames {
+		for i := 0; i < len(m.Pix); i += 4 {
+			if m.Pix[i+3] != 0 {
+				counts[[3]uint8{m.Pix[i+0], m.Pix[i+1], m.Pix[i+2]}]++
+			}
+		}
+	}
+	colors := make([]gifColor, 0, len(counts))
+	for rgb, n := range counts {
+		colors = append(colors, gifColor{rgb, n})
+	}
+	if len(colors) == 0 {
+		return append(palette, color.RGBA{A: 0xff})
+	}
+
+	// Split the box of the largest range, weighted by its pixels, at its
+	// median, until there are enough boxes.
+	boxes := [][]gifColor{colors}
+	for len(boxes) < numColors {
+		best, bestScore, bestAxis := -1, 0, 0
+		for i, box := range boxes {
+			if len(box) < 2 {
+				continue
+			}
+			axis, span := gifBoxAxis(box)
+			var count int
+			for _, c := range box {
+				count += c.count
+			}
+			if score := span * count; score > bestScore {
+				best, bestScore, bestAxis = i, score, axis
+			}
+		}
+		if best < 0 {
+			break
+		}
+
+		box := boxes[best]
+		sort.Slice(box, func(i, j int) bool { return box[i].rgb[bestAxis] < box[j].rgb[bestAxis] })
+		var total, half int
+		for _, c := range box {
+			total += c.count
+		}
+		split := 1
+		for half = box[0].count; split < len(box)-1 && 2*half < total; split++ {
+			half += box[split].count
+		}
+		boxes[best] = box[:split]
+		boxes = append(boxes, box[split:])
+	}
+
+	for _, box := range boxes {
+		var r, g, b, n int
+		for _, c := range box {
+			r += int(c.rgb[0]) * c.count
+			g += int(c.rgb[1]) * c.count
+			b += int(c.rgb[2]) * c.count
+			n += c.count
+		}
+		palette = append(palette, color.RGBA{uint8((r + n/2) / n), uint8((g + n/2) / n), uint8((b + n/2) / n), 0xff})
+	}
+	return palette
+}
+
+// gifBoxAxis returns the channel of the largest range of box, and the range.
+func gifBoxAxis(box []gifColor) (axis, span int) {
+	for c := 0; c < 3; c++ {
+		lo, hi := 255, 0
+		for _, v := range box {
+			lo, hi = minInt(lo, int(v.rgb[c])), maxInt(hi, int(v.rgb[c]))
+		}
+		if hi-lo > span {
+			axis, span = c, hi-lo
+		}
+	}
+	return
+}
+
+// gifQuantize maps the pixels of m to palette, whose first color is the
+// transparent one if m has transparent pixels. The error is diffused with
+// Floyd-Steinberg if dither is set.
+func gifQuantize(m *image.NRGBA, palette color.Palette, dither bool) *image.Paletted {
+	dst := image.NewPaletted(m.Rect, palette)
+	first := 0
+	if _, _, _, a := palette[0].RGBA(); a == 0 {
+		first = 1
+	}
+	cache := make(map[[3]uint8]uint8)
+	nearest := func(rgb [3]uint8) uint8 {
+		if i, ok := cache[rgb]; ok {
+			return i
+		}
+		best, bestDist := first, 1<<30
+		for i := first; i < len(palette); i++ {
+			c := palette[i].(color.RGBA)
+			dr, dg, db := int(c.R)-int(rgb[0]), int(c.G)-int(rgb[1]), int(c.B)-int(rgb[2])
+			if dist := dr*dr + dg*dg + db*db; dist < bestDist {
+				best, bestDist = i, dist
+			}
+		}
+		cache[rgb] = uint8(best)
+		return uint8(best)
+	}
+
+	width := m.Rect.Dx()
+	// The errors of the current and next rows, with a margin on each side.
+	cur, next := make([][3]int, width+2), make([][3]int, width+2)
+	for y := 0; y < m.Rect.Dy(); y++ {
+		src := m.Pix[y*m.Stride:][:4*width]
+		for x := 0; x < width; x++ {
+			if src[4*x+3] == 0 {
+				dst.Pix[y*dst.Stride+x] = 0
+				continue
+			}
+			var rgb [3]uint8
+			for c := 0; c < 3; c++ {
+				rgb[c] = clampUint8(int(src[4*x+c]) + cur[x+1][c])
+			}
+			i := nearest(rgb)
+			dst.Pix[y*dst.Stride+x] = i
+			if !dither {
+				continue
+			}
+			q := palette[i].(color.RGBA)
+			for c, v := range [3]uint8{q.R, q.G, q.B} {
+				e := int(rgb[c]) - int(v)
+				cur[x+2][c] += e * 7 / 16
+				next[x+0][c] += e * 3 / 16
+				next[x+1][c] += e * 5 / 16
+				next[x+2][c] += e * 1 / 16
+			}
+		}
+		cur, next = next, cur
+		for i := range next {
+			next[i] = [3]int{}
+		}
+	}
+	return dst
+}
@@ -0,0 +1,633 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build cgo
+
+package gowebp
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+var tAnimationColors = []color.RGBA{
+	{R: 0xff, A: 0xff},
+	{G: 0xff, A: 0xff},
+	{B: 0xff, A: 0xff},
+}
+
+func newTestAnimation(t *testing.T, loopCount int) []byte {
+	anim := NewWebpAnimation(64, 48, loopCount)
+	defer anim.Close()
+
+	config := NewWebpConfig()
+	config.SetLossless(1)
+
+	timestamp := 0
+	for i, c := range tAnimationColors {
+		m := image.NewRGBA(image.Rect(0, 0, 64, 48))
+		draw.Draw(m, m.Bounds(), image.NewUniform(c), image.Point{}, draw.Src)
+		if err := anim.AddFrame(m, timestamp, config); err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		timestamp += 100 * (i + 1)
+	}
+	if err := anim.AddFrame(nil, timestamp, config); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := new(bytes.Buffer)
+	if err := anim.Encode(buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestGetFeatures_animation(t *testing.T) {
+	data := newTestAnimation(t, 3)
+
+	f, err := GetFeatures(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tAssert(t, f.HasAnimation)
+	tAssertEQ(t, FormatLossless, f.Format)
+	tAssertEQ(t, 64, f.Width)
+	tAssertEQ(t, 48, f.Height)
+	tAssertEQ(t, len(tAnimationColors), f.FrameCount)
+	tAssertEQ(t, 3, f.LoopCount)
+	tAssertBetween(t, 1, 64, float64(f.FrameWidth))
+	tAssertBetween(t, 1, 48, float64(f.FrameHeight))
+
+	_, err = GetFeatures(data[:8])
+	tAssertNotNil(t, err)
+}
+
+func TestDecodeAll(t *testing.T) {
+	data := newTestAnimation(t, 3)
+
+	anim, err := DecodeAll(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tAssertEQ(t, 64, anim.Config.Width)
+	tAssertEQ(t, 48, anim.Config.Height)
+	tAssertEQ(t, 3, anim.LoopCount)
+	tAssertEQ(t, len(tAnimationColors), len(anim.Image))
+	tAssertEQ(t, []int{100, 200, 300}, anim.Delay)
+
+	for i, m := range anim.Image {
+		tAssertEQ(t, image.Rect(0, 0, 64, 48), m.Bounds())
+		tAssertEQ(t, tAnimationColors[i], m.RGBAAt(32, 24))
+	}
+}
+
+func TestDecodeAll_limits(t *testing.T) {
+	data := newTestAnimation(t, 3)
+
+	// MaxPixels bounds all the frames, each the size of the canvas.
+	for _, v := range []struct {
+		opt DecodeOptions
+		err error
+	}{
+		{DecodeOptions{MaxPixels: 3 * 64 * 48}, nil},
+		{DecodeOptions{MaxPixels: 3*64*48 - 1}, ErrImageTooLarge},
+		{DecodeOptions{MaxWidth: 64, MaxHeight: 48}, nil},
+		{DecodeOptions{MaxWidth: 63}, ErrImageTooLarge},
+		{DecodeOptions{MaxHeight: 47, UseThreads: true}, ErrImageTooLarge},
+	} {
+		_, err := DecodeAllWithOptions(bytes.NewReader(data), &v.opt)
+		tAssertEQ(t, v.err, err, v.opt)
+	}
+}
+
+func TestDecodeAll_still(t *testing.T) {
+	data, err := ioutil.ReadFile(testdataDir + "1_webp_ll.webp")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	anim, err := DecodeAll(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tAssertEQ(t, 1, len(anim.Image))
+	tAssertEQ(t, 400, anim.Config.Width)
+	tAssertEQ(t, 301, anim.Config.Height)
+}
+
+func TestWebpAnimation_frameOptions(t *testing.T) {
+	anim := NewWebpAnimation(64, 48, 0)
+	defer anim.Close()
+
+	background := image.NewRGBA(image.Rect(0, 0, 64, 48))
+	draw.Draw(background, background.Bounds(), image.NewUniform(tAnimationColors[0]), image.Point{}, draw.Src)
+	square := image.NewRGBA(image.Rect(0, 0, 16, 16))
+	draw.Draw(square, square.Bounds(), image.NewUniform(color.RGBA{B: 0x80, A: 0x80}), image.Point{}, draw.Src)
+
+	frames := []struct {
+		m   image.Image
+		opt FrameOptions
+	}{
+		{background, FrameOptions{Duration: 100, Lossless: true}},
+		{square, FrameOptions{Duration: 50, Offset: image.Pt(10, 8), Dispose: WebpMuxDisposeBackground, Lossless: true}},
+		{square, FrameOptions{Duration: 70, Offset: image.Pt(40, 30), Blend: WebpMuxNoBlend, Lossless: true}},
+	}
+	for i, f := range frames {
+		if err := anim.AddFrameWithOptions(f.m, f.opt); err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+	}
+	tAssertNotNil(t, anim.AddFrameWithOptions(square, FrameOptions{Offset: image.Pt(1, 0)}))
+	tAssertNotNil(t, anim.AddFrameWithOptions(square, FrameOptions{Offset: image.Pt(50, 0)}))
+	tAssertNotNil(t, anim.AddFrame(background, 0, NewWebpConfig()))
+
+	buf := new(bytes.Buffer)
+	if err := anim.Encode(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	// The frames are stored as given.
+	chunks, _, err := riffChunks(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored := riffFrames(chunks)
+	tAssertEQ(t, len(frames), len(stored))
+	for i, f := range stored {
+		opt := frames[i].opt
+		tAssertEQ(t, opt.Offset, image.Pt(f.x, f.y), i)
+		tAssertEQ(t, frames[i].m.Bounds().Size(), image.Pt(f.width, f.height), i)
+		tAssertEQ(t, opt.Duration, f.duration, i)
+		tAssertEQ(t, opt.Blend == WebpMuxBlend, f.blend, i)
+		tAssertEQ(t, opt.Dispose == WebpMuxDisposeBackground, f.dispose, i)
+	}
+
+	decoded, err := DecodeAnimation(buf.Bytes(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tAssertEQ(t, []int{100, 50, 70}, decoded.Delay)
+	tAssertEQ(t, 0, decoded.LoopCount)
+	blended := decoded.Image[1].RGBAAt(12, 10)
+	tAssertEQ(t, color.RGBA{R: 0x7f, B: 0x80, A: 0xff}, blended)
+	tAssertEQ(t, color.RGBA{}, decoded.Image[2].RGBAAt(12, 10))
+	tAssertEQ(t, color.RGBA{B: 0x80, A: 0x80}, decoded.Image[2].RGBAAt(42, 32))
+	tAssertEQ(t, tAnimationColors[0], decoded.Image[2].RGBAAt(0, 0))
+}
+
+// The frames of AddFrame and AddFrameWithOptions do not mix, and the encoder
+// settings only apply to AddFrame.
+func TestWebpAnimation_frameOptionsMixed(t *testing.T) {
+	m := image.NewRGBA(image.Rect(0, 0, 64, 48))
+
+	anim := NewWebpAnimation(64, 48, 0)
+	defer anim.Close()
+	if err := anim.AddFrame(m, 0, NewWebpConfig()); err != nil {
+		t.Fatal(err)
+	}
+	tAssertNotNil(t, anim.AddFrameWithOptions(m, FrameOptions{Duration: 100}))
+
+	for i, v := range []struct {
+		opts AnimationOptions
+		ok   bool
+	}{
+		{AnimationOptions{LoopCount: 2, BackgroundColor: color.White, XMP: []byte("<x/>")}, true},
+		{AnimationOptions{MinimizeSize: true}, false},
+		{AnimationOptions{Kmin: 1, Kmax: 2}, false},
+		{AnimationOptions{AllowMixed: true}, false},
+	} {
+		anim, err := NewWebpAnimationWithOptions(64, 48, &v.opts)
+		if err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		err = anim.AddFrameWithOptions(m, FrameOptions{Duration: 100})
+		tAssertEQ(t, v.ok, err == nil, i, err)
+		if !v.ok {
+			if err = anim.AddFrame(m, 0, NewWebpConfig()); err != nil {
+				t.Fatalf("%d: %v", i, err)
+			}
+		}
+		anim.Close()
+	}
+}
+
+func TestWebpAnimation_close(t *testing.T) {
+	config := NewWebpConfig()
+	config.SetLossless(1)
+	m := image.NewRGBA(image.Rect(0, 0, 64, 48))
+
+	anim := NewWebpAnimation(64, 48, 0)
+	if err := anim.AddFrame(m, 0, config); err != nil {
+		t.Fatal(err)
+	}
+	tAssertEQ(t, 0, len(anim.WebPPictures))
+	tAssertEQ(t, nil, anim.Close())
+	tAssertEQ(t, nil, anim.Close())
+	anim.ReleaseMemory()
+	tAssertNotNil(t, anim.AddFrame(m, 100, config))
+	tAssertNotNil(t, anim.Encode(new(bytes.Buffer)))
+}
+
+func TestWebpAnimation_finish(t *testing.T) {
+	data := newTestAnimation(t, 3)
+
+	anim := NewWebpAnimation(64, 48, 3)
+	config := NewWebpConfig()
+	config.SetLossless(1)
+	timestamp := 0
+	for i, c := range tAnimationColors {
+		m := image.NewRGBA(image.Rect(0, 0, 64, 48))
+		draw.Draw(m, m.Bounds(), image.NewUniform(c), image.Point{}, draw.Src)
+		if err := anim.AddFrame(m, timestamp, config); err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		timestamp += 100 * (i + 1)
+	}
+	if err := anim.AddFrame(nil, timestamp, config); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := new(bytes.Buffer)
+	if err := anim.Finish(buf); err != nil {
+		t.Fatal(err)
+	}
+	tAssert(t, bytes.Equal(data, buf.Bytes()))
+	tAssertNotNil(t, anim.Encode(buf))
+}
+
+func TestNewWebpAnimationWithOptions(t *testing.T) {
+	opts := &AnimationOptions{
+		LoopCount:       1,
+		BackgroundColor: color.NRGBA{R: 0x10, G: 0x20, B: 0x30, A: 0x40},
+		MinimizeSize:    true,
+		Kmin:            2,
+		Kmax:            4,
+		ICC:             []byte("icc profile"),
+		EXIF:            []byte("exif data"),
+		XMP:             []byte("<xmp/>"),
+	}
+	config := NewWebpConfig()
+	config.SetLossless(1)
+
+	for _, numFrames := range []int{1, 3} {
+		anim, err := NewWebpAnimationWithOptions(64, 48, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < numFrames; i++ {
+			m := image.NewRGBA(image.Rect(0, 0, 64, 48))
+			draw.Draw(m, m.Bounds(), image.NewUniform(tAnimationColors[i]), image.Point{}, draw.Src)
+			if err = anim.AddFrame(m, 100*i, config); err != nil {
+				t.Fatalf("%d: %v", i, err)
+			}
+		}
+		if err = anim.AddFrame(nil, 100*numFrames, config); err != nil {
+			t.Fatal(err)
+		}
+		buf := new(bytes.Buffer)
+		if err = anim.Finish(buf); err != nil {
+			t.Fatal(err)
+		}
+		data := buf.Bytes()
+
+		for _, m := range []struct {
+			format string
+			data   []byte
+		}{{"ICCP", opts.ICC}, {"EXIF", opts.EXIF}, {"XMP", opts.XMP}} {
+			metadata, err := GetMetadata(data, m.format)
+			if err != nil {
+				t.Fatalf("%d, %s: %v", numFrames, m.format, err)
+			}
+			tAssertEQ(t, m.data, metadata, numFrames, m.format)
+		}
+
+		decoded, err := DecodeAnimation(data, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tAssertEQ(t, numFrames, len(decoded.Image))
+		if numFrames > 1 {
+			tAssertEQ(t, 1, decoded.LoopCount)
+			tAssertEQ(t, opts.BackgroundColor, decoded.BackgroundColor)
+		}
+	}
+
+	// The frames of AddFrameWithOptions, with the default loop count.
+	anim, err := NewWebpAnimationWithOptions(64, 48, &AnimationOptions{XMP: opts.XMP})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer anim.Close()
+	for i, c := range tAnimationColors {
+		m := image.NewRGBA(image.Rect(0, 0, 64, 48))
+		draw.Draw(m, m.Bounds(), image.NewUniform(c), image.Point{}, draw.Src)
+		if err = anim.AddFrameWithOptions(m, FrameOptions{Duration: 100, Lossless: true}); err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+	}
+	buf := new(bytes.Buffer)
+	if err = anim.Encode(buf); err != nil {
+		t.Fatal(err)
+	}
+	metadata, err := GetMetadata(buf.Bytes(), "XMP")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tAssertEQ(t, opts.XMP, metadata)
+	features, err := GetFeatures(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tAssertEQ(t, 0, features.LoopCount)
+
+	_, err = NewWebpAnimationWithOptions(64, 48, &AnimationOptions{LoopCount: -1})
+	tAssertNotNil(t, err)
+	_, err = NewWebpAnimationWithOptions(64, 48, &AnimationOptions{Kmax: -1})
+	tAssertNotNil(t, err)
+}
+
+func TestWebpAnimationWriter(t *testing.T) {
+	f, err := os.CreateTemp(t.TempDir(), "*.webp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	// The animation does not need to start the file.
+	if _, err = f.WriteString("head"); err != nil {
+		t.Fatal(err)
+	}
+
+	aw, err := NewWebpAnimationWriter(f, 64, 48, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A writer which cannot seek gets the same animation on Close.
+	var stream bytes.Buffer
+	streamAW, err := NewWebpAnimationWriter(struct{ io.Writer }{&stream}, 64, 48, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := NewWebpConfig()
+	config.SetLossless(1)
+
+	// A square moving on a transparent canvas, the third frame repeating
+	// the second one.
+	var frames []*image.RGBA
+	for i, x := range []int{0, 21, 21, 40} {
+		m := image.NewRGBA(image.Rect(0, 0, 64, 48))
+		draw.Draw(m, image.Rect(x, 11, x+16, 27), image.NewUniform(tAnimationColors[x%3]), image.Point{}, draw.Src)
+		if err = aw.AddFrame(m, 100*i, config); err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		if err = streamAW.AddFrame(m, 100*i, config); err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		frames = append(frames, m)
+	}
+	tAssertNotNil(t, aw.AddFrame(frames[0], 300, config))
+	if err = aw.AddFrame(nil, 450, config); err != nil {
+		t.Fatal(err)
+	}
+	tAssertNotNil(t, aw.AddFrame(frames[0], 500, config))
+	tAssertEQ(t, nil, aw.Close())
+	tAssertEQ(t, nil, aw.Close())
+	if err = streamAW.AddFrame(nil, 450, config); err != nil {
+		t.Fatal(err)
+	}
+	tAssertEQ(t, 0, stream.Len())
+	tAssertEQ(t, nil, streamAW.Close())
+
+	data, err := ioutil.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tAssertEQ(t, "head", string(data[:4]))
+	data = data[4:]
+	tAssert(t, bytes.Equal(data, stream.Bytes()))
+
+	features, err := GetFeatures(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tAssert(t, features.HasAnimation)
+	tAssert(t, features.HasAlpha)
+
+	anim, err := DecodeAnimation(data, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tAssertEQ(t, 2, anim.LoopCount)
+	tAssertEQ(t, []int{100, 200, 150}, anim.Delay)
+	for i, j := range []int{0, 1, 3} {
+		tAssert(t, bytes.Equal(frames[j].Pix, anim.Image[i].Pix), i)
+	}
+
+	// Only the changed rectangles are stored.
+	chunks, _, err := riffChunks(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored := riffFrames(chunks)
+	tAssertEQ(t, 3, len(stored))
+	tAssertEQ(t, image.Rect(0, 10, 37, 27), image.Rect(stored[1].x, stored[1].y, stored[1].x+stored[1].width, stored[1].y+stored[1].height))
+
+	_, err = NewWebpAnimationWriter(f, 0, 48, 0)
+	tAssertNotNil(t, err)
+	aw, err = NewWebpAnimationWriter(f, 64, 48, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tAssertNotNil(t, aw.Close())
+}
+
+func TestFromGIF(t *testing.T) {
+	red, green, blue := color.RGBA{R: 0xff, A: 0xff}, color.RGBA{G: 0xff, A: 0xff}, color.RGBA{B: 0xff, A: 0xff}
+	global := color.Palette{red, green, blue}
+	withTransparent := color.Palette{red, green, color.RGBA{}}
+
+	background := image.NewPaletted(image.Rect(0, 0, 20, 10), global)
+	square := image.NewPaletted(image.Rect(4, 2, 8, 6), withTransparent)
+	for i := range square.Pix {
+		square.Pix[i] = 1
+	}
+	square.SetColorIndex(4, 2, 2)
+	bar := image.NewPaletted(image.Rect(10, 0, 12, 10), global)
+	for i := range bar.Pix {
+		bar.Pix[i] = 2
+	}
+	bar2 := image.NewPaletted(image.Rect(14, 0, 16, 10), global)
+	for i := range bar2.Pix {
+		bar2.Pix[i] = 1
+	}
+
+	g := &gif.GIF{
+		Image:           []*image.Paletted{background, square, bar, bar2},
+		Delay:           []int{5, 0, 20, 1},
+		Disposal:        []byte{gif.DisposalNone, gif.DisposalBackground, gif.DisposalPrevious, 0},
+		LoopCount:       2,
+		BackgroundIndex: 1,
+		Config:          image.Config{ColorModel: global, Width: 20, Height: 10},
+	}
+	data, err := FromGIF(g, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	anim, err := DecodeAnimation(data, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tAssertEQ(t, []int{50, 100, 200, 100}, anim.Delay)
+	tAssertEQ(t, 3, anim.LoopCount)
+	tAssertEQ(t, color.NRGBA{G: 0xff, A: 0xff}, anim.BackgroundColor)
+	tAssertEQ(t, 20, anim.Config.Width)
+
+	// The transparent pixel shows the frame below.
+	tAssertEQ(t, red, anim.Image[1].RGBAAt(4, 2))
+	tAssertEQ(t, green, anim.Image[1].RGBAAt(5, 2))
+	// The square is cleared to transparent, the bar is drawn over.
+	tAssertEQ(t, color.RGBA{}, anim.Image[2].RGBAAt(5, 2))
+	tAssertEQ(t, blue, anim.Image[2].RGBAAt(10, 5))
+	tAssertEQ(t, red, anim.Image[2].RGBAAt(0, 0))
+	// The bar is disposed to the previous canvas.
+	tAssertEQ(t, red, anim.Image[3].RGBAAt(11, 5))
+	tAssertEQ(t, green, anim.Image[3].RGBAAt(15, 5))
+	tAssertEQ(t, color.RGBA{}, anim.Image[3].RGBAAt(6, 4))
+
+	// A GIF without loop extension plays once, a still GIF gives a still
+	// image, and a transparent background index gives a transparent background.
+	g.LoopCount = -1
+	g.BackgroundIndex = 2
+	g.Image[0] = square
+	if data, err = FromGIF(g, &GIFOptions{Lossy: true, Quality: 50}); err != nil {
+		t.Fatal(err)
+	}
+	if anim, err = DecodeAnimation(data, nil); err != nil {
+		t.Fatal(err)
+	}
+	tAssertEQ(t, 1, anim.LoopCount)
+	tAssertEQ(t, color.NRGBA{}, anim.BackgroundColor)
+
+	g.Image, g.Delay, g.Disposal = g.Image[:1], g.Delay[:1], g.Disposal[:1]
+	if data, err = FromGIF(g, nil); err != nil {
+		t.Fatal(err)
+	}
+	f, err := GetFeatures(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tAssertFalse(t, f.HasAnimation)
+}
+
+func TestGIFLoopCount(t *testing.T) {
+	for _, v := range []struct {
+		webp, gif int
+	}{
+		{0, 0},
+		{1, -1},
+		{2, 1},
+		{65535, 65534},
+	} {
+		tAssertEQ(t, v.gif, gifFromLoopCount(v.webp), v)
+		tAssertEQ(t, v.webp, gifLoopCount(&gif.GIF{Image: make([]*image.Paletted, 2), LoopCount: v.gif}), v)
+	}
+}
+
+// A GIF playing once keeps playing once through WEBP and back.
+func TestToGIF_playOnce(t *testing.T) {
+	frames := make([]*image.Paletted, 2)
+	for i := range frames {
+		frames[i] = image.NewPaletted(image.Rect(0, 0, 8, 8), color.Palette{color.Black, color.White})
+		frames[i].Pix[i] = 1
+	}
+	buf := new(bytes.Buffer)
+	err := gif.EncodeAll(buf, &gif.GIF{Image: frames, Delay: []int{10, 10}, LoopCount: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, err := gif.DecodeAll(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tAssertEQ(t, -1, g.LoopCount)
+
+	data, err := FromGIF(g, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	anim, err := DecodeAnimation(data, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tAssertEQ(t, 1, anim.LoopCount)
+	if g, err = ToGIF(anim, nil); err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+	if err = gif.EncodeAll(buf, g); err != nil {
+		t.Fatal(err)
+	}
+	if g, err = gif.DecodeAll(buf); err != nil {
+		t.Fatal(err)
+	}
+	tAssertEQ(t, -1, g.LoopCount)
+	tAssertEQ(t, len(frames), len(g.Image))
+}
+
+func TestToGIF(t *testing.T) {
+	anim, err := DecodeAnimation(newTestAnimation(t, 3), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	anim.Image[1].SetRGBA(5, 5, color.RGBA{})
+
+	for _, opts := range []*ToGIFOptions{nil, {GlobalPalette: true}, {Dither: true, NumColors: 4}} {
+		g, err := ToGIF(anim, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf := new(bytes.Buffer)
+		if err := gif.EncodeAll(buf, g); err != nil {
+			t.Fatal(err)
+		}
+		if g, err = gif.DecodeAll(buf); err != nil {
+			t.Fatal(err)
+		}
+		tAssertEQ(t, []int{10, 20, 30}, g.Delay)
+		tAssertEQ(t, 2, g.LoopCount)
+		tAssertEQ(t, len(anim.Image), len(g.Image))
+		for i, m := range g.Image {
+			tAssertEQ(t, 0, averageDelta(anim.Image[i], m), i)
+			tAssertEQ(t, byte(gif.DisposalBackground), g.Disposal[i])
+		}
+	}
+
+	// A photo, with a few colors.
+	data, err := ioutil.ReadFile(testdataDir + "yellow_rose.lossy.webp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if anim, err = DecodeAnimation(data, nil); err != nil {
+		t.Fatal(err)
+	}
+	for _, dither := range []bool{false, true} {
+		g, err := ToGIF(anim, &ToGIFOptions{NumColors: 16, Dither: dither})
+		if err != nil {
+			t.Fatal(err)
+		}
+		tAssertEQ(t, 16, len(g.Image[0].Palette))
+		tAssertEQ(t, byte(gif.DisposalNone), g.Disposal[0])
+		tAssertLE(t, averageDelta(anim.Image[0], g.Image[0]), 12)
+	}
+
+	_, err = ToGIF(anim, &ToGIFOptions{NumColors: 1})
+	tAssertNotNil(t, err)
+}
@@ -6,6 +6,7 @@ package gowebp
 
 import (
 	"bytes"
+	"image"
 	"io/ioutil"
 	"testing"
 )
@@ -70,6 +71,25 @@ func BenchmarkDecodeRGBA(b *testing.B) {
 	b.StopTimer()
 }
 
+func BenchmarkDecodeRGBAInto(b *testing.B) {
+	data, err := ioutil.ReadFile("./testdata/1_webp_ll.webp")
+	if err != nil {
+		b.Fatal(err)
+	}
+	width, height, _, err := GetInfo(data)
+	if err != nil {
+		b.Fatal(err)
+	}
+	m := image.NewRGBA(image.Rect(0, 0, width, height))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := DecodeRGBAInto(m, data, nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.StopTimer()
+}
+
 func BenchmarkDecodeGrayToSize(b *testing.B) {
 	data, err := ioutil.ReadFile("./testdata/1_webp_ll.webp")
 	if err != nil {
@@ -0,0 +1,36 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gowebp
+
+// Capabilities reports what the package supports in the current build.
+//
+// Built with cgo, the package wraps libwebp and supports everything. Built
+// without cgo, as with CGO_ENABLED=0, it falls back to pure Go: the
+// high-level API is the same, but the raw libwebp bindings (the WebP*
+// functions and types other than WebPConfig, and WebpAnimation) are left
+// out, and lossy encoding returns an error matching
+// VP8EncErrorInvalidConfiguration.
+type Capabilities struct {
+	// Cgo reports whether the package is built on libwebp.
+	Cgo bool
+	// DecoderTuning reports whether BypassFiltering, UseThreads and the
+	// dithering of DecodeOptions apply. Crop, scaling, flip and
+	// NoFancyUpsampling always do.
+	DecoderTuning bool
+	// IncrementalDecode reports whether IncrementalDecoder decodes rows as
+	// the data arrives, rather than once the image is complete.
+	IncrementalDecode bool
+	// EncodeLossy reports whether lossy encoding is supported.
+	EncodeLossy bool
+	// EncodeLossless reports whether lossless encoding is supported.
+	EncodeLossless bool
+	// EncodeAnimation reports whether WebpAnimation is available.
+	EncodeAnimation bool
+}
+
+// GetCapabilities returns the capabilities of the current build.
+func GetCapabilities() Capabilities {
+	return capabilities
+}
@@ -26,18 +26,31 @@ package gowebp
 #include "webp.h"
 
 #include <webp/decode.h>
+#include <webp/demux.h>
 
 #include <stdlib.h>
 */
 import "C"
 import (
 	"errors"
+	"image"
+	"image/color"
+	"runtime/cgo"
 	"unsafe"
 )
 
+var capabilities = Capabilities{
+	Cgo:               true,
+	DecoderTuning:     true,
+	IncrementalDecode: true,
+	EncodeLossy:       true,
+	EncodeLossless:    true,
+	EncodeAnimation:   true,
+}
+
 func webpGetInfo(data []byte) (width, height int, hasAlpha bool, err error) {
 	if len(data) == 0 {
-		err = errors.New("webpGetInfo: bad arguments, data is empty")
+		err = newDecodeError("webpGetInfo", VP8StatusNotEnoughData)
 		return
 	}
 	if len(data) > maxWebpHeaderSize {
@@ -45,8 +58,8 @@ func webpGetInfo(data []byte) (width, height int, hasAlpha bool, err error) {
 	}
 
 	var features C.WebPBitstreamFeatures
-	if C.WebPGetFeatures((*C.uint8_t)(unsafe.Pointer(&data[0])), C.size_t(len(data)), &features) != C.VP8_STATUS_OK {
-		err = errors.New("C.WebPGetFeatures: failed")
+	if status := C.WebPGetFeatures((*C.uint8_t)(unsafe.Pointer(&data[0])), C.size_t(len(data)), &features); status != C.VP8_STATUS_OK {
+		err = newDecodeError("WebPGetFeatures", VP8StatusCode(status))
 		return
 	}
 	width, height = int(features.width), int(features.height)
@@ -54,288 +67,393 @@ func webpGetInfo(data []byte) (width, height int, hasAlpha bool, err error) {
 	return
 }
 
-func webpDecodeGray(data []byte) (pix []byte, width, height int, err error) {
+func webpGetFeatures(data []byte) (features Features, err error) {
 	if len(data) == 0 {
-		err = errors.New("webpDecodeGray: bad arguments")
-		return
-	}
-
-	var cw, ch C.int
-	var cptr = C.webpDecodeGray((*C.uint8_t)(unsafe.Pointer(&data[0])), C.size_t(len(data)), &cw, &ch)
-	if cptr == nil {
-		err = errors.New("webpDecodeGray: failed")
-		return
+		err = newDecodeError("webpGetFeatures", VP8StatusNotEnoughData)
+		return
+	}
+
+	var f C.webpFeatures
+	if status := C.webpGetFeatures((*C.uint8_t)(unsafe.Pointer(&data[0])), C.size_t(len(data)), &f); status != C.VP8_STATUS_OK {
+		err = newDecodeError("webpGetFeatures", VP8StatusCode(status))
+		return
+	}
+	features = Features{
+		Width:        int(f.canvas_width),
+		Height:       int(f.canvas_height),
+		FrameWidth:   int(f.frame_width),
+		FrameHeight:  int(f.frame_height),
+		Format:       Format(f.format),
+		HasAlpha:     f.has_alpha != 0,
+		HasAnimation: f.has_animation != 0,
+		HasICC:       f.flags&vp8xFlagICC != 0,
+		HasEXIF:      f.flags&vp8xFlagEXIF != 0,
+		HasXMP:       f.flags&vp8xFlagXMP != 0,
+		FrameCount:   int(f.frame_count),
+		LoopCount:    int(f.loop_count),
+		BackgroundColor: color.NRGBA{
+			R: uint8(f.bgcolor >> 16),
+			G: uint8(f.bgcolor >> 8),
+			B: uint8(f.bgcolor >> 0),
+			A: uint8(f.bgcolor >> 24),
+		},
 	}
-	defer C.free(unsafe.Pointer(cptr))
-
-	pix = make([]byte, int(cw*ch*1))
-	copy(pix, ((*[1 << 30]byte)(unsafe.Pointer(cptr)))[0:len(pix):len(pix)])
-	width, height = int(cw), int(ch)
 	return
 }
 
-func webpDecodeRGB(data []byte) (pix []byte, width, height int, err error) {
-	if len(data) == 0 {
-		err = errors.New("webpDecodeRGB: bad arguments")
-		return
-	}
+func webpDecodeGrayInto(data []byte, opt *webpDecoderOptions, pix []byte, width, height, stride int) error {
+	return webpDecodeInto("webpDecodeGrayInto", data, opt, C.MODE_YUV, 1, pix, width, height, stride)
+}
 
-	var cw, ch C.int
-	var cptr = C.webpDecodeRGB((*C.uint8_t)(unsafe.Pointer(&data[0])), C.size_t(len(data)), &cw, &ch)
-	if cptr == nil {
-		err = errors.New("webpDecodeRGB: failed")
-		return
-	}
-	defer C.free(unsafe.Pointer(cptr))
+func webpDecodeRGBInto(data []byte, opt *webpDecoderOptions, pix []byte, width, height, stride int) error {
+	return webpDecodeInto("webpDecodeRGBInto", data, opt, C.MODE_RGB, 3, pix, width, height, stride)
+}
 
-	pix = make([]byte, int(cw*ch*3))
-	copy(pix, ((*[1 << 30]byte)(unsafe.Pointer(cptr)))[0:len(pix):len(pix)])
-	width, height = int(cw), int(ch)
-	return
+// webpDecodeRGBAInto decodes premultiplied RGBA pixels.
+func webpDecodeRGBAInto(data []byte, opt *webpDecoderOptions, pix []byte, width, height, stride int) error {
+	return webpDecodeInto("webpDecodeRGBAInto", data, opt, C.MODE_rgbA, 4, pix, width, height, stride)
 }
 
-func webpDecodeRGBA(data []byte) (pix []byte, width, height int, err error) {
-	if len(data) == 0 {
-		err = errors.New("webpDecodeRGBA: bad arguments")
-		return
-	}
+// webpDecodeNRGBAInto decodes non-premultiplied RGBA pixels.
+func webpDecodeNRGBAInto(data []byte, opt *webpDecoderOptions, pix []byte, width, height, stride int) error {
+	return webpDecodeInto("webpDecodeNRGBAInto", data, opt, C.MODE_RGBA, 4, pix, width, height, stride)
+}
 
-	var cw, ch C.int
-	var cptr = C.webpDecodeRGBA((*C.uint8_t)(unsafe.Pointer(&data[0])), C.size_t(len(data)), &cw, &ch)
-	if cptr == nil {
-		err = errors.New("webpDecodeRGBA: failed")
-		return
+func webpDecodeModeInto(data []byte, opt *webpDecoderOptions, mode ColorMode, pix []byte, width, height, stride int) error {
+	if !mode.valid() {
+		return newDecodeError("webpDecodeModeInto", VP8StatusInvalidParam)
 	}
-	defer C.free(unsafe.Pointer(cptr))
+	return webpDecodeInto("webpDecodeModeInto", data, opt, C.WEBP_CSP_MODE(mode), mode.BytesPerPixel(), pix, width, height, stride)
+}
 
-	pix = make([]byte, int(cw*ch*4))
-	copy(pix, ((*[1 << 30]byte)(unsafe.Pointer(cptr)))[0:len(pix):len(pix)])
-	width, height = int(cw), int(ch)
+func (opt *webpDecoderOptions) toC() (options C.WebPDecoderOptions) {
+	if !opt.Crop.Empty() {
+		options.use_cropping = 1
+		options.crop_left = C.int(opt.Crop.Min.X)
+		options.crop_top = C.int(opt.Crop.Min.Y)
+		options.crop_width = C.int(opt.Crop.Dx())
+		options.crop_height = C.int(opt.Crop.Dy())
+	}
+	if opt.ScaledWidth != 0 || opt.ScaledHeight != 0 {
+		options.use_scaling = 1
+		options.scaled_width = C.int(opt.ScaledWidth)
+		options.scaled_height = C.int(opt.ScaledHeight)
+	}
+	options.bypass_filtering = cbool(opt.BypassFiltering)
+	options.no_fancy_upsampling = cbool(opt.NoFancyUpsampling)
+	options.use_threads = cbool(opt.UseThreads)
+	options.dithering_strength = C.int(opt.DitheringStrength)
+	options.alpha_dithering_strength = C.int(opt.AlphaDitheringStrength)
+	options.flip = cbool(opt.Flip)
 	return
 }
 
-func webpDecodeGrayToSize(data []byte, width, height int) (pix []byte, err error) {
-	pix = make([]byte, int(width*height))
-	stride := C.int(width)
-	res := C.webpDecodeGrayToSize((*C.uint8_t)(unsafe.Pointer(&data[0])), C.size_t(len(data)), C.int(width), C.int(height), stride, (*C.uint8_t)(unsafe.Pointer(&pix[0])))
-	if res != C.VP8_STATUS_OK {
-		pix = nil
-		err = errors.New("webpDecodeGrayToSize: failed")
+func cbool(v bool) C.int {
+	if v {
+		return 1
 	}
-	return
+	return 0
 }
 
-func webpDecodeRGBToSize(data []byte, width, height int) (pix []byte, err error) {
-	pix = make([]byte, int(3*width*height))
-	stride := C.int(3 * width)
-	res := C.webpDecodeRGBToSize((*C.uint8_t)(unsafe.Pointer(&data[0])), C.size_t(len(data)), C.int(width), C.int(height), stride, (*C.uint8_t)(unsafe.Pointer(&pix[0])))
-	if res != C.VP8_STATUS_OK {
-		pix = nil
-		err = errors.New("webpDecodeRGBToSize: failed")
+// webpDecodeInto decodes data straight into pix, which holds height rows of
+// width pixels, stride bytes apart. The size of the (cropped and scaled)
+// image must match.
+func webpDecodeInto(op string, data []byte, opt *webpDecoderOptions, colorspace C.WEBP_CSP_MODE, channels int, pix []byte, width, height, stride int) error {
+	if len(data) == 0 {
+		return newDecodeError(op, VP8StatusNotEnoughData)
+	}
+	if width <= 0 || height <= 0 || stride < width*channels || len(pix) < (height-1)*stride+width*channels {
+		return newDecodeError(op, VP8StatusInvalidParam)
+	}
+	// libwebp would write into pix before rejecting a size mismatch.
+	if w, h, err := opt.outputSize(data); err != nil {
+		return err
+	} else if w != width || h != height {
+		return newDecodeError(op, VP8StatusInvalidParam)
 	}
-	return
-}
 
-func webpDecodeRGBAToSize(data []byte, width, height int) (pix []byte, err error) {
-	pix = make([]byte, int(4*width*height))
-	stride := C.int(4 * width)
-	res := C.webpDecodeRGBAToSize((*C.uint8_t)(unsafe.Pointer(&data[0])), C.size_t(len(data)), C.int(width), C.int(height), stride, (*C.uint8_t)(unsafe.Pointer(&pix[0])))
-	if res != C.VP8_STATUS_OK {
-		pix = nil
-		err = errors.New("webpDecodeRGBAToSize: failed")
+	var options *C.WebPDecoderOptions
+	if opt != nil {
+		copt := opt.toC()
+		options = &copt
 	}
-	return
+	status := C.webpDecodeInto(
+		(*C.uint8_t)(unsafe.Pointer(&data[0])), C.size_t(len(data)),
+		options, C.int(colorspace),
+		(*C.uint8_t)(unsafe.Pointer(&pix[0])), C.int(width), C.int(height), C.int(stride), C.size_t(len(pix)),
+	)
+	if status != C.VP8_STATUS_OK {
+		return newDecodeError(op, VP8StatusCode(status))
+	}
+	return nil
 }
 
-func webpEncodeGray(pix []byte, width, height, stride int, quality float32) (output []byte, err error) {
-	if len(pix) == 0 || width <= 0 || height <= 0 || stride <= 0 || quality < 0.0 {
-		err = errors.New("webpEncodeGray: bad arguments")
-		return
+// webpDecodeYCbCrInto decodes the raw Y'CbCr planes of data into m, and the
+// alpha plane into a if it is not nil. The chroma of m must be 4:2:0.
+func webpDecodeYCbCrInto(data []byte, opt *webpDecoderOptions, m *image.YCbCr, a []byte, aStride int) error {
+	const op = "webpDecodeYCbCrInto"
+	if len(data) == 0 {
+		return newDecodeError(op, VP8StatusNotEnoughData)
 	}
-	if stride < width*1 && len(pix) < height*stride {
-		err = errors.New("webpEncodeGray: bad arguments")
-		return
+	width, height := m.Rect.Dx(), m.Rect.Dy()
+	if width <= 0 || height <= 0 || m.SubsampleRatio != image.YCbCrSubsampleRatio420 {
+		return newDecodeError(op, VP8StatusInvalidParam)
 	}
 
-	var cptr_size C.size_t
-	var cptr = C.webpEncodeGray(
-		(*C.uint8_t)(unsafe.Pointer(&pix[0])), C.int(width), C.int(height),
-		C.int(stride), C.float(quality),
-		&cptr_size,
+	var options *C.WebPDecoderOptions
+	if opt != nil {
+		copt := opt.toC()
+		options = &copt
+	}
+	var aptr *C.uint8_t
+	if a != nil {
+		aptr = (*C.uint8_t)(unsafe.Pointer(&a[0]))
+	}
+	y := m.Y[m.YOffset(m.Rect.Min.X, m.Rect.Min.Y):]
+	cb := m.Cb[m.COffset(m.Rect.Min.X, m.Rect.Min.Y):]
+	cr := m.Cr[m.COffset(m.Rect.Min.X, m.Rect.Min.Y):]
+	if len(cr) < len(cb) {
+		cb = cb[:len(cr)]
+	}
+	status := C.webpDecodeYUVAInto(
+		(*C.uint8_t)(unsafe.Pointer(&data[0])), C.size_t(len(data)),
+		options,
+		(*C.uint8_t)(unsafe.Pointer(&y[0])), C.int(m.YStride), C.size_t(len(y)),
+		(*C.uint8_t)(unsafe.Pointer(&cb[0])), (*C.uint8_t)(unsafe.Pointer(&cr[0])), C.int(m.CStride), C.size_t(len(cb)),
+		aptr, C.int(aStride), C.size_t(len(a)),
+		C.int(width), C.int(height),
 	)
-	if cptr == nil || cptr_size == 0 {
-		err = errors.New("webpEncodeGray: failed")
-		return
+	if status != C.VP8_STATUS_OK {
+		return newDecodeError(op, VP8StatusCode(status))
 	}
-	defer C.free(unsafe.Pointer(cptr))
+	return nil
+}
 
-	output = make([]byte, int(cptr_size))
-	copy(output, ((*[1 << 30]byte)(unsafe.Pointer(cptr)))[0:len(output):len(output)])
-	return
+// webpDecodeStatus returns the status of the header of data, or
+// VP8StatusBitstreamError if the header is valid, for the APIs that only
+// report a failure.
+func webpDecodeStatus(data []byte) VP8StatusCode {
+	var features C.WebPBitstreamFeatures
+	if status := C.WebPGetFeatures((*C.uint8_t)(unsafe.Pointer(&data[0])), C.size_t(len(data)), &features); status != C.VP8_STATUS_OK {
+		return VP8StatusCode(status)
+	}
+	return VP8StatusBitstreamError
 }
 
-func webpEncodeRGB(pix []byte, width, height, stride int, quality float32) (output []byte, err error) {
-	if len(pix) == 0 || width <= 0 || height <= 0 || stride <= 0 || quality < 0.0 {
-		err = errors.New("webpEncodeRGB: bad arguments")
+func webpDecodeAnimation(data []byte, opt *DecodeOptions) (frames [][]byte, timestamps []int, width, height, loopCount int, bgcolor uint32, err error) {
+	if len(data) == 0 {
+		err = newDecodeError("webpDecodeAnimation", VP8StatusNotEnoughData)
 		return
 	}
-	if stride < width*3 && len(pix) < height*stride {
-		err = errors.New("webpEncodeRGB: bad arguments")
+
+	// The decoder allocates the canvas, so the limits are checked first.
+	features, err := webpGetFeatures(data)
+	if err != nil {
 		return
 	}
-
-	var cptr_size C.size_t
-	var cptr = C.webpEncodeRGB(
-		(*C.uint8_t)(unsafe.Pointer(&pix[0])), C.int(width), C.int(height),
-		C.int(stride), C.float(quality),
-		&cptr_size,
-	)
-	if cptr == nil || cptr_size == 0 {
-		err = errors.New("webpEncodeRGB: failed")
+	if err = opt.checkAnimationSize(features.Width, features.Height, features.FrameCount); err != nil {
 		return
 	}
-	defer C.free(unsafe.Pointer(cptr))
 
-	output = make([]byte, int(cptr_size))
-	copy(output, ((*[1 << 30]byte)(unsafe.Pointer(cptr)))[0:len(output):len(output)])
-	return
-}
+	// The decoder keeps a reference to its input, so it must live in C memory.
+	var cdata = C.CBytes(data)
+	defer C.free(cdata)
 
-func webpEncodeRGBA(pix []byte, width, height, stride int, quality float32) (output []byte, err error) {
-	if len(pix) == 0 || width <= 0 || height <= 0 || stride <= 0 || quality < 0.0 {
-		err = errors.New("webpEncodeRGBA: bad arguments")
+	var options C.WebPAnimDecoderOptions
+	if C.WebPAnimDecoderOptionsInitInternal(&options, C.WEBP_DEMUX_ABI_VERSION) == 0 {
+		err = newDecodeError("webpDecodeAnimation", VP8StatusInvalidParam)
 		return
 	}
-	if stride < width*4 && len(pix) < height*stride {
-		err = errors.New("webpEncodeRGBA: bad arguments")
-		return
+	options.color_mode = C.MODE_rgbA
+	options.use_threads = 1
+	if opt != nil {
+		options.use_threads = cbool(opt.UseThreads)
 	}
 
-	var cptr_size C.size_t
-	var cptr = C.webpEncodeRGBA(
-		(*C.uint8_t)(unsafe.Pointer(&pix[0])), C.int(width), C.int(height),
-		C.int(stride), C.float(quality),
-		&cptr_size,
-	)
-	if cptr == nil || cptr_size == 0 {
-		err = errors.New("webpEncodeRGBA: failed")
+	var webpData C.WebPData
+	webpData.bytes = (*C.uint8_t)(cdata)
+	webpData.size = C.size_t(len(data))
+
+	var dec = C.WebPAnimDecoderNewInternal(&webpData, &options, C.WEBP_DEMUX_ABI_VERSION)
+	if dec == nil {
+		err = newDecodeError("webpDecodeAnimation", webpDecodeStatus(data))
 		return
 	}
-	defer C.free(unsafe.Pointer(cptr))
+	defer C.WebPAnimDecoderDelete(dec)
 
-	output = make([]byte, int(cptr_size))
-	copy(output, ((*[1 << 30]byte)(unsafe.Pointer(cptr)))[0:len(output):len(output)])
-	return
-}
-
-func webpEncodeLosslessGray(pix []byte, width, height, stride int) (output []byte, err error) {
-	if len(pix) == 0 || width <= 0 || height <= 0 || stride <= 0 {
-		err = errors.New("webpEncodeLosslessGray: bad arguments")
+	var info C.WebPAnimInfo
+	if C.WebPAnimDecoderGetInfo(dec, &info) == 0 {
+		err = newDecodeError("webpDecodeAnimation", VP8StatusInvalidParam)
 		return
 	}
-	if stride < width*1 && len(pix) < height*stride {
-		err = errors.New("webpEncodeLosslessGray: bad arguments")
+	width, height = int(info.canvas_width), int(info.canvas_height)
+	loopCount, bgcolor = int(info.loop_count), uint32(info.bgcolor)
+	if err = opt.checkAnimationSize(width, height, int(info.frame_count)); err != nil {
 		return
 	}
 
-	var cptr_size C.size_t
-	var cptr = C.webpEncodeLosslessGray(
-		(*C.uint8_t)(unsafe.Pointer(&pix[0])), C.int(width), C.int(height),
-		C.int(stride),
-		&cptr_size,
-	)
-	if cptr == nil || cptr_size == 0 {
-		err = errors.New("webpEncodeLosslessGray: failed")
-		return
-	}
-	defer C.free(unsafe.Pointer(cptr))
+	frames = make([][]byte, 0, int(info.frame_count))
+	timestamps = make([]int, 0, int(info.frame_count))
+	for C.WebPAnimDecoderHasMoreFrames(dec) != 0 {
+		var cptr *C.uint8_t
+		var timestamp C.int
+		if C.WebPAnimDecoderGetNext(dec, &cptr, &timestamp) == 0 {
+			frames, timestamps = nil, nil
+			err = newDecodeError("webpDecodeAnimation", VP8StatusBitstreamError)
+			return
+		}
 
-	output = make([]byte, int(cptr_size))
-	copy(output, ((*[1 << 30]byte)(unsafe.Pointer(cptr)))[0:len(output):len(output)])
+		pix := make([]byte, width*height*4)
+		copy(pix, ((*[1 << 30]byte)(unsafe.Pointer(cptr)))[0:len(pix):len(pix)])
+		frames = append(frames, pix)
+		timestamps = append(timestamps, int(timestamp))
+	}
 	return
 }
 
-func webpEncodeLosslessRGB(pix []byte, width, height, stride int) (output []byte, err error) {
-	if len(pix) == 0 || width <= 0 || height <= 0 || stride <= 0 {
-		err = errors.New("webpEncodeLosslessRGB: bad arguments")
+func webpEncodeConfig(config WebPConfig, pix []byte, width, height, stride, channels int, stats *EncodeStats, progress *encodeProgress) (output []byte, err error) {
+	if len(pix) == 0 || width <= 0 || height <= 0 || stride < width*channels {
+		err = newEncodeError("webpEncodeConfig", VP8EncErrorBadDimension)
 		return
 	}
-	if stride < width*3 && len(pix) < height*stride {
-		err = errors.New("webpEncodeLosslessRGB: bad arguments")
+	if len(pix) < (height-1)*stride+width*channels {
+		err = newEncodeError("webpEncodeConfig", VP8EncErrorBadDimension)
 		return
 	}
 
+	var cstats *C.WebPAuxStats
+	if stats != nil {
+		cstats = new(C.WebPAuxStats)
+	}
+
+	var handle cgo.Handle
+	if progress != nil {
+		handle = cgo.NewHandle(progress)
+		defer handle.Delete()
+	}
+
 	var cptr_size C.size_t
-	var cptr = C.webpEncodeLosslessRGB(
+	var errorCode C.int
+	var cptr = C.webpEncodeConfig(
+		config.getRawPointer(),
 		(*C.uint8_t)(unsafe.Pointer(&pix[0])), C.int(width), C.int(height),
-		C.int(stride),
-		&cptr_size,
+		C.int(stride), C.int(channels),
+		cstats, C.uintptr_t(handle),
+		&cptr_size, &errorCode,
 	)
 	if cptr == nil || cptr_size == 0 {
-		err = errors.New("webpEncodeLosslessRGB: failed")
+		err = newEncodeError("webpEncodeConfig", WebPEncodingError(errorCode))
 		return
 	}
 	defer C.free(unsafe.Pointer(cptr))
 
+	if stats != nil {
+		stats.setFrom(cstats)
+	}
+
 	output = make([]byte, int(cptr_size))
 	copy(output, ((*[1 << 30]byte)(unsafe.Pointer(cptr)))[0:len(output):len(output)])
 	return
 }
 
-func webpEncodeLosslessRGBA(exact int, pix []byte, width, height, stride int) (output []byte, err error) {
-	if len(pix) == 0 || width <= 0 || height <= 0 || stride <= 0 {
-		err = errors.New("webpEncodeLosslessRGBA: bad arguments")
+// webpEncodeYCbCr encodes the planes of m, and the alpha plane a if it is
+// not nil, without going through RGB. The chroma of m must be 4:2:0, and
+// m.Rect.Min must be even.
+func webpEncodeYCbCr(config WebPConfig, m *image.YCbCr, a []byte, aStride int, stats *EncodeStats, progress *encodeProgress) (output []byte, err error) {
+	const op = "webpEncodeYCbCr"
+	width, height := m.Rect.Dx(), m.Rect.Dy()
+	if width <= 0 || height <= 0 || m.SubsampleRatio != image.YCbCrSubsampleRatio420 || m.Rect.Min.X%2 != 0 || m.Rect.Min.Y%2 != 0 {
+		err = newEncodeError(op, VP8EncErrorBadDimension)
 		return
 	}
-	if stride < width*4 && len(pix) < height*stride {
-		err = errors.New("webpEncodeLosslessRGBA: bad arguments")
+	y := m.Y[m.YOffset(m.Rect.Min.X, m.Rect.Min.Y):]
+	cb := m.Cb[m.COffset(m.Rect.Min.X, m.Rect.Min.Y):]
+	cr := m.Cr[m.COffset(m.Rect.Min.X, m.Rect.Min.Y):]
+	cw, ch := (width+1)/2, (height+1)/2
+	if len(y) < (height-1)*m.YStride+width || len(cb) < (ch-1)*m.CStride+cw || len(cr) < (ch-1)*m.CStride+cw {
+		err = newEncodeError(op, VP8EncErrorBadDimension)
 		return
 	}
-
-	var cptr_size C.size_t
-	var cptr = C.webpEncodeLosslessRGBA(
-		C.int(exact), (*C.uint8_t)(unsafe.Pointer(&pix[0])), C.int(width), C.int(height),
-		C.int(stride),
-		&cptr_size,
-	)
-	if cptr == nil || cptr_size == 0 {
-		err = errors.New("webpEncodeLosslessRGBA: failed")
-		return
+	var aptr *C.uint8_t
+	if a != nil {
+		if len(a) < (height-1)*aStride+width {
+			err = newEncodeError(op, VP8EncErrorBadDimension)
+			return
+		}
+		aptr = (*C.uint8_t)(unsafe.Pointer(&a[0]))
 	}
-	defer C.free(unsafe.Pointer(cptr))
 
-	output = make([]byte, int(cptr_size))
-	copy(output, ((*[1 << 30]byte)(unsafe.Pointer(cptr)))[0:len(output):len(output)])
-	return
-}
-
-func webpEncodeLosslessNRGBA(exact int, pix []byte, width, height, stride int) (output []byte, err error) {
-	if len(pix) == 0 || width <= 0 || height <= 0 || stride <= 0 {
-		err = errors.New("webpEncodeLosslessRGBA: bad arguments")
-		return
+	var cstats *C.WebPAuxStats
+	if stats != nil {
+		cstats = new(C.WebPAuxStats)
 	}
-	if stride < width*4 && len(pix) < height*stride {
-		err = errors.New("webpEncodeLosslessRGBA: bad arguments")
-		return
+
+	var handle cgo.Handle
+	if progress != nil {
+		handle = cgo.NewHandle(progress)
+		defer handle.Delete()
 	}
 
 	var cptr_size C.size_t
-	var cptr = C.webpEncodeLosslessRGBA(
-		C.int(exact), (*C.uint8_t)(unsafe.Pointer(&pix[0])), C.int(width), C.int(height),
-		C.int(stride),
-		&cptr_size,
+	var errorCode C.int
+	var cptr = C.webpEncodeYUVA(
+		config.getRawPointer(),
+		(*C.uint8_t)(unsafe.Pointer(&y[0])), C.int(m.YStride),
+		(*C.uint8_t)(unsafe.Pointer(&cb[0])), (*C.uint8_t)(unsafe.Pointer(&cr[0])), C.int(m.CStride),
+		aptr, C.int(aStride),
+		C.int(width), C.int(height),
+		cstats, C.uintptr_t(handle),
+		&cptr_size, &errorCode,
 	)
 	if cptr == nil || cptr_size == 0 {
-		err = errors.New("webpEncodeLosslessRGBA: failed")
+		err = newEncodeError(op, WebPEncodingError(errorCode))
 		return
 	}
 	defer C.free(unsafe.Pointer(cptr))
 
+	if stats != nil {
+		stats.setFrom(cstats)
+	}
+
 	output = make([]byte, int(cptr_size))
 	copy(output, ((*[1 << 30]byte)(unsafe.Pointer(cptr)))[0:len(output):len(output)])
 	return
 }
 
+func (stats *EncodeStats) setFrom(cstats *C.WebPAuxStats) {
+	stats.CodedSize = int(cstats.coded_size)
+	for i := range stats.PSNR {
+		stats.PSNR[i] = float32(cstats.PSNR[i])
+	}
+	for i := range stats.BlockCount {
+		stats.BlockCount[i] = int(cstats.block_count[i])
+	}
+	for i := range stats.HeaderBytes {
+		stats.HeaderBytes[i] = int(cstats.header_bytes[i])
+	}
+	for i := range stats.ResidualBytes {
+		for j := range stats.ResidualBytes[i] {
+			stats.ResidualBytes[i][j] = int(cstats.residual_bytes[i][j])
+		}
+	}
+	for i := range stats.SegmentSize {
+		stats.SegmentSize[i] = int(cstats.segment_size[i])
+		stats.SegmentQuant[i] = int(cstats.segment_quant[i])
+		stats.SegmentLevel[i] = int(cstats.segment_level[i])
+	}
+	stats.AlphaDataSize = int(cstats.alpha_data_size)
+	stats.LayerDataSize = int(cstats.layer_data_size)
+
+	stats.LosslessFeatures = LosslessFeatures(cstats.lossless_features)
+	stats.HistogramBits = int(cstats.histogram_bits)
+	stats.TransformBits = int(cstats.transform_bits)
+	stats.CacheBits = int(cstats.cache_bits)
+	stats.PaletteSize = int(cstats.palette_size)
+	stats.LosslessSize = int(cstats.lossless_size)
+	stats.LosslessHdrSize = int(cstats.lossless_hdr_size)
+	stats.LosslessDataSize = int(cstats.lossless_data_size)
+}
+
 func webpGetEXIF(data []byte) (metadata []byte, err error) {
 	if len(data) == 0 {
 		err = errors.New("webpGetEXIF: bad arguments")
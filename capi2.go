@@ -10,10 +10,12 @@ package gowebp
 
 #include "webp/encode.h"
 #include "webp/mux.h"
+#include <stdlib.h>
 */
 import "C"
 import (
 	"errors"
+	"io"
 	"unsafe"
 )
 
@@ -33,12 +35,40 @@ const (
 	WebpMuxNotEnoughData   = WebPMuxError(C.WEBP_MUX_NOT_ENOUGH_DATA)
 )
 
+// WebPMuxAnimDispose is the dispose method of an animation frame.
+type WebPMuxAnimDispose int
+
+const (
+	WebpMuxDisposeNone       = WebPMuxAnimDispose(C.WEBP_MUX_DISPOSE_NONE)       // Do not dispose.
+	WebpMuxDisposeBackground = WebPMuxAnimDispose(C.WEBP_MUX_DISPOSE_BACKGROUND) // Dispose to the background color.
+)
+
+// WebPMuxAnimBlend is the blend method of an animation frame.
+type WebPMuxAnimBlend int
+
+const (
+	WebpMuxBlend   = WebPMuxAnimBlend(C.WEBP_MUX_BLEND)    // Blend with alpha.
+	WebpMuxNoBlend = WebPMuxAnimBlend(C.WEBP_MUX_NO_BLEND) // Do not blend.
+)
+
+type WebPPreset int
+
+const (
+	WebpPresetDefault = WebPPreset(C.WEBP_PRESET_DEFAULT) // default preset.
+	WebpPresetPicture = WebPPreset(C.WEBP_PRESET_PICTURE) // digital picture, like portrait, inner shot
+	WebpPresetPhoto   = WebPPreset(C.WEBP_PRESET_PHOTO)   // outdoor photograph, with natural lighting
+	WebpPresetDrawing = WebPPreset(C.WEBP_PRESET_DRAWING) // hand or line drawing, with high-contrast details
+	WebpPresetIcon    = WebPPreset(C.WEBP_PRESET_ICON)    // small-sized colorful images
+	WebpPresetText    = WebPPreset(C.WEBP_PRESET_TEXT)    // text-like
+)
+
 type WebPPicture C.WebPPicture
 type WebPAnimEncoder C.WebPAnimEncoder
 type WebPAnimEncoderOptions C.WebPAnimEncoderOptions
 type WebPData C.WebPData
 type WebPMux C.WebPMux
 type WebPMuxAnimParams C.WebPMuxAnimParams
+type WebPMuxFrameInfo C.WebPMuxFrameInfo
 type webPConfig struct {
 	webpConfig *C.WebPConfig
 }
@@ -68,6 +98,7 @@ type WebPConfig interface {
 	SetLowMemory(v int)
 	SetNearLossless(v int)
 	SetExact(v int)
+	GetExact() int
 	SetUseDeltaPalette(v int)
 	SetUseSharpYuv(v int)
 	SetAlphaQuality(v int)
@@ -127,6 +158,15 @@ func (wpd WebPData) GetBytes() []byte {
 	return C.GoBytes(unsafe.Pointer(((C.WebPData)(wpd)).bytes), (C.int)(((C.WebPData)(wpd)).size))
 }
 
+// WriteTo writes the data to w, straight from the C memory.
+func (wpd *WebPData) WriteTo(w io.Writer) (int64, error) {
+	if wpd.bytes == nil {
+		return 0, nil
+	}
+	n, err := w.Write(unsafe.Slice((*byte)(unsafe.Pointer(wpd.bytes)), int(wpd.size)))
+	return int64(n), err
+}
+
 func WebPDataInit(webPData *WebPData) {
 	C.WebPDataInit((*C.WebPData)(unsafe.Pointer(webPData)))
 }
@@ -148,6 +188,30 @@ func WebPConfigInitInternal(config WebPConfig) int {
 	))
 }
 
+// WebPConfigPreset resets config to the values of preset, for the given
+// quality factor.
+func WebPConfigPreset(config WebPConfig, preset WebPPreset, quality float32) int {
+	return int(C.WebPConfigInitInternal(
+		config.getRawPointer(),
+		(C.WebPPreset)(preset),
+		(C.float)(quality),
+		(C.int)(WebpEncoderAbiVersion),
+	))
+}
+
+// WebPConfigLosslessPreset activates the lossless compression mode with the
+// desired efficiency level between 0 (fastest, lowest compression) and 9
+// (slower, best compression). It returns 0 if level is out of range.
+func WebPConfigLosslessPreset(config WebPConfig, level int) int {
+	return int(C.WebPConfigLosslessPreset(config.getRawPointer(), (C.int)(level)))
+}
+
+// WebPValidateConfig returns 1 if all the config parameters are within
+// their valid ranges, and 0 otherwise.
+func WebPValidateConfig(config WebPConfig) int {
+	return int(C.WebPValidateConfig(config.getRawPointer()))
+}
+
 func (webpCfg *webPConfig) getRawPointer() *C.WebPConfig {
 	return webpCfg.webpConfig
 }
@@ -244,6 +308,10 @@ func (webpCfg *webPConfig) SetExact(v int) {
 	webpCfg.webpConfig.exact = (C.int)(v)
 }
 
+func (webpCfg *webPConfig) GetExact() int {
+	return int(webpCfg.webpConfig.exact)
+}
+
 func (webpCfg *webPConfig) SetUseDeltaPalette(v int) {
 	webpCfg.webpConfig.use_delta_palette = (C.int)(v)
 }
@@ -364,3 +432,74 @@ func WebPMuxAssemble(webPMux *WebPMux, webPData *WebPData) WebPMuxError {
 		(*C.WebPData)(unsafe.Pointer(webPData)),
 	))
 }
+
+// WebPMuxNew creates an empty mux object.
+func WebPMuxNew() *WebPMux {
+	return (*WebPMux)(C.WebPNewInternal((C.int)(WebpMuxAbiVersion)))
+}
+
+func WebPMuxSetCanvasSize(webPMux *WebPMux, width, height int) WebPMuxError {
+	return (WebPMuxError)(C.WebPMuxSetCanvasSize(
+		(*C.WebPMux)(unsafe.Pointer(webPMux)),
+		(C.int)(width),
+		(C.int)(height),
+	))
+}
+
+func (info *WebPMuxFrameInfo) SetOffset(x, y int) {
+	(*C.WebPMuxFrameInfo)(info).x_offset = (C.int)(x)
+	(*C.WebPMuxFrameInfo)(info).y_offset = (C.int)(y)
+}
+
+func (info *WebPMuxFrameInfo) SetDuration(v int) {
+	(*C.WebPMuxFrameInfo)(info).duration = (C.int)(v)
+}
+
+func (info *WebPMuxFrameInfo) SetDisposeMethod(v WebPMuxAnimDispose) {
+	(*C.WebPMuxFrameInfo)(info).dispose_method = (C.WebPMuxAnimDispose)(v)
+}
+
+func (info *WebPMuxFrameInfo) SetBlendMethod(v WebPMuxAnimBlend) {
+	(*C.WebPMuxFrameInfo)(info).blend_method = (C.WebPMuxAnimBlend)(v)
+}
+
+// WebPMuxPushFrame adds a frame at the end of the animation of webPMux.
+// bitstream is a WEBP file, or a VP8/VP8L bitstream, and is copied by the
+// mux.
+func WebPMuxPushFrame(webPMux *WebPMux, info *WebPMuxFrameInfo, bitstream []byte) WebPMuxError {
+	if len(bitstream) == 0 {
+		return WebpMuxInvalidArgument
+	}
+	cinfo := *(*C.WebPMuxFrameInfo)(info)
+	cinfo.id = C.WEBP_CHUNK_ANMF
+	cinfo.bitstream.bytes = (*C.uint8_t)(C.CBytes(bitstream))
+	cinfo.bitstream.size = (C.size_t)(len(bitstream))
+	defer C.free(unsafe.Pointer(cinfo.bitstream.bytes))
+
+	return (WebPMuxError)(C.WebPMuxPushFrame(
+		(*C.WebPMux)(unsafe.Pointer(webPMux)),
+		&cinfo,
+		1,
+	))
+}
+
+// WebPMuxSetChunk sets the chunk fourcc of webPMux, like "ICCP", "EXIF" or
+// "XMP ", replacing any previous one. data is copied by the mux.
+func WebPMuxSetChunk(webPMux *WebPMux, fourcc string, data []byte) WebPMuxError {
+	if len(fourcc) != 4 || len(data) == 0 {
+		return WebpMuxInvalidArgument
+	}
+	cfourcc := C.CString(fourcc)
+	defer C.free(unsafe.Pointer(cfourcc))
+	var cdata C.WebPData
+	cdata.bytes = (*C.uint8_t)(C.CBytes(data))
+	cdata.size = (C.size_t)(len(data))
+	defer C.free(unsafe.Pointer(cdata.bytes))
+
+	return (WebPMuxError)(C.WebPMuxSetChunk(
+		(*C.WebPMux)(unsafe.Pointer(webPMux)),
+		cfourcc,
+		&cdata,
+		1,
+	))
+}
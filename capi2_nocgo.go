@@ -0,0 +1,303 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !cgo
+
+package gowebp
+
+// Without cgo, WebPConfig keeps the settings in Go, with the defaults and
+// the range checks of libwebp. Only Lossless and Exact are used by the pure
+// Go encoder.
+
+type WebPPreset int
+
+const (
+	WebpPresetDefault WebPPreset = 0 // default preset.
+	WebpPresetPicture WebPPreset = 1 // digital picture, like portrait, inner shot
+	WebpPresetPhoto   WebPPreset = 2 // outdoor photograph, with natural lighting
+	WebpPresetDrawing WebPPreset = 3 // hand or line drawing, with high-contrast details
+	WebpPresetIcon    WebPPreset = 4 // small-sized colorful images
+	WebpPresetText    WebPPreset = 5 // text-like
+)
+
+// WebPMaxDimension is the maximum width or height of an image.
+const WebPMaxDimension = int(16383)
+
+type webPConfig struct {
+	lossless         int
+	quality          float32
+	method           int
+	imageHint        int
+	targetSize       int
+	targetPSNR       float32
+	segments         int
+	snsStrength      int
+	filterStrength   int
+	filterSharpness  int
+	filterType       int
+	autofilter       int
+	alphaCompression int
+	alphaFiltering   int
+	alphaQuality     int
+	pass             int
+	showCompressed   int
+	preprocessing    int
+	partitions       int
+	partitionLimit   int
+	emulateJpegSize  int
+	threadLevel      int
+	lowMemory        int
+	nearLossless     int
+	exact            int
+	useDeltaPalette  int
+	useSharpYuv      int
+}
+
+type WebPConfig interface {
+	getConfig() *webPConfig
+	SetLossless(v int)
+	GetLossless() int
+	SetMethod(v int)
+	SetImageHint(v int)
+	SetTargetSize(v int)
+	SetTargetPSNR(v float32)
+	SetSegments(v int)
+	SetSnsStrength(v int)
+	SetFilterStrength(v int)
+	SetFilterSharpness(v int)
+	SetAutofilter(v int)
+	SetAlphaCompression(v int)
+	SetAlphaFiltering(v int)
+	SetPass(v int)
+	SetShowCompressed(v int)
+	SetPreprocessing(v int)
+	SetPartitions(v int)
+	SetPartitionLimit(v int)
+	SetEmulateJpegSize(v int)
+	SetThreadLevel(v int)
+	SetLowMemory(v int)
+	SetNearLossless(v int)
+	SetExact(v int)
+	GetExact() int
+	SetUseDeltaPalette(v int)
+	SetUseSharpYuv(v int)
+	SetAlphaQuality(v int)
+	SetFilterType(v int)
+	SetQuality(v float32)
+}
+
+// NewWebpConfig create webpconfig instance
+func NewWebpConfig() WebPConfig {
+	webpcfg := &webPConfig{}
+	WebPConfigInitInternal(webpcfg)
+	return webpcfg
+}
+
+func WebPConfigInitInternal(config WebPConfig) int {
+	return WebPConfigPreset(config, WebpPresetDefault, 75)
+}
+
+// WebPConfigPreset resets config to the values of preset, for the given
+// quality factor.
+func WebPConfigPreset(config WebPConfig, preset WebPPreset, quality float32) int {
+	c := config.getConfig()
+	*c = webPConfig{
+		quality:          quality,
+		method:           4,
+		segments:         4,
+		snsStrength:      50,
+		filterStrength:   60,
+		filterType:       1,
+		alphaCompression: 1,
+		alphaFiltering:   1,
+		alphaQuality:     100,
+		pass:             1,
+		nearLossless:     100,
+	}
+	switch preset {
+	case WebpPresetDefault:
+	case WebpPresetPicture:
+		c.snsStrength, c.filterSharpness, c.filterStrength = 80, 4, 35
+		c.preprocessing &^= 2
+	case WebpPresetPhoto:
+		c.snsStrength, c.filterSharpness, c.filterStrength = 80, 3, 30
+		c.preprocessing |= 2
+	case WebpPresetDrawing:
+		c.snsStrength, c.filterSharpness, c.filterStrength = 25, 6, 10
+	case WebpPresetIcon:
+		c.snsStrength, c.filterStrength = 0, 0
+		c.preprocessing &^= 2
+	case WebpPresetText:
+		c.snsStrength, c.filterStrength, c.segments = 0, 0, 2
+		c.preprocessing &^= 2
+	default:
+		return 0
+	}
+	return WebPValidateConfig(config)
+}
+
+// WebPConfigLosslessPreset activates the lossless compression mode with the
+// desired efficiency level between 0 (fastest, lowest compression) and 9
+// (slower, best compression). It returns 0 if level is out of range.
+func WebPConfigLosslessPreset(config WebPConfig, level int) int {
+	presets := [10]struct {
+		method  int
+		quality float32
+	}{
+		{0, 0}, {1, 20}, {2, 25}, {3, 30}, {3, 50},
+		{4, 50}, {4, 75}, {4, 90}, {5, 90}, {6, 100},
+	}
+	if level < 0 || level >= len(presets) {
+		return 0
+	}
+	c := config.getConfig()
+	c.lossless = 1
+	c.method, c.quality = presets[level].method, presets[level].quality
+	return 1
+}
+
+// WebPValidateConfig returns 1 if all the config parameters are within
+// their valid ranges, and 0 otherwise.
+func WebPValidateConfig(config WebPConfig) int {
+	c := config.getConfig()
+	in := func(v, min, max int) bool { return v >= min && v <= max }
+	if c.quality < 0 || c.quality > 100 || c.targetSize < 0 || c.targetPSNR < 0 {
+		return 0
+	}
+	if !in(c.method, 0, 6) || !in(c.imageHint, 0, 3) || !in(c.segments, 1, 4) ||
+		!in(c.snsStrength, 0, 100) || !in(c.filterStrength, 0, 100) ||
+		!in(c.filterSharpness, 0, 7) || !in(c.filterType, 0, 1) ||
+		!in(c.autofilter, 0, 1) || !in(c.pass, 1, 10) ||
+		!in(c.showCompressed, 0, 1) || !in(c.preprocessing, 0, 7) ||
+		!in(c.partitions, 0, 3) || !in(c.partitionLimit, 0, 100) ||
+		!in(c.alphaCompression, 0, 1) || !in(c.alphaFiltering, 0, 2) ||
+		!in(c.alphaQuality, 0, 100) || !in(c.lossless, 0, 1) ||
+		!in(c.nearLossless, 0, 100) || !in(c.emulateJpegSize, 0, 1) ||
+		!in(c.threadLevel, 0, 1) || !in(c.lowMemory, 0, 1) ||
+		!in(c.exact, 0, 1) || !in(c.useDeltaPalette, 0, 1) ||
+		!in(c.useSharpYuv, 0, 1) {
+		return 0
+	}
+	return 1
+}
+
+func (webpCfg *webPConfig) getConfig() *webPConfig {
+	return webpCfg
+}
+
+func (webpCfg *webPConfig) SetLossless(v int) {
+	webpCfg.lossless = v
+}
+
+func (webpCfg *webPConfig) GetLossless() int {
+	return webpCfg.lossless
+}
+
+func (webpCfg *webPConfig) SetMethod(v int) {
+	webpCfg.method = v
+}
+
+func (webpCfg *webPConfig) SetImageHint(v int) {
+	webpCfg.imageHint = v
+}
+
+func (webpCfg *webPConfig) SetTargetSize(v int) {
+	webpCfg.targetSize = v
+}
+
+func (webpCfg *webPConfig) SetTargetPSNR(v float32) {
+	webpCfg.targetPSNR = v
+}
+
+func (webpCfg *webPConfig) SetSegments(v int) {
+	webpCfg.segments = v
+}
+
+func (webpCfg *webPConfig) SetSnsStrength(v int) {
+	webpCfg.snsStrength = v
+}
+
+func (webpCfg *webPConfig) SetFilterStrength(v int) {
+	webpCfg.filterStrength = v
+}
+
+func (webpCfg *webPConfig) SetFilterSharpness(v int) {
+	webpCfg.filterSharpness = v
+}
+
+func (webpCfg *webPConfig) SetAutofilter(v int) {
+	webpCfg.autofilter = v
+}
+
+func (webpCfg *webPConfig) SetAlphaCompression(v int) {
+	webpCfg.alphaCompression = v
+}
+
+func (webpCfg *webPConfig) SetAlphaFiltering(v int) {
+	webpCfg.alphaFiltering = v
+}
+
+func (webpCfg *webPConfig) SetPass(v int) {
+	webpCfg.pass = v
+}
+
+func (webpCfg *webPConfig) SetShowCompressed(v int) {
+	webpCfg.showCompressed = v
+}
+
+func (webpCfg *webPConfig) SetPreprocessing(v int) {
+	webpCfg.preprocessing = v
+}
+
+func (webpCfg *webPConfig) SetPartitions(v int) {
+	webpCfg.partitions = v
+}
+
+func (webpCfg *webPConfig) SetPartitionLimit(v int) {
+	webpCfg.partitionLimit = v
+}
+
+func (webpCfg *webPConfig) SetEmulateJpegSize(v int) {
+	webpCfg.emulateJpegSize = v
+}
+
+func (webpCfg *webPConfig) SetThreadLevel(v int) {
+	webpCfg.threadLevel = v
+}
+
+func (webpCfg *webPConfig) SetLowMemory(v int) {
+	webpCfg.lowMemory = v
+}
+
+func (webpCfg *webPConfig) SetNearLossless(v int) {
+	webpCfg.nearLossless = v
+}
+
+func (webpCfg *webPConfig) SetExact(v int) {
+	webpCfg.exact = v
+}
+
+func (webpCfg *webPConfig) GetExact() int {
+	return webpCfg.exact
+}
+
+func (webpCfg *webPConfig) SetUseDeltaPalette(v int) {
+	webpCfg.useDeltaPalette = v
+}
+
+func (webpCfg *webPConfig) SetUseSharpYuv(v int) {
+	webpCfg.useSharpYuv = v
+}
+
+func (webpCfg *webPConfig) SetAlphaQuality(v int) {
+	webpCfg.alphaQuality = v
+}
+
+func (webpCfg *webPConfig) SetFilterType(v int) {
+	webpCfg.filterType = v
+}
+
+func (webpCfg *webPConfig) SetQuality(v float32) {
+	webpCfg.quality = v
+}
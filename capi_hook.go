@@ -0,0 +1,25 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gowebp
+
+// Files with //export can only have declarations in their preamble, so the
+// C side of the hooks lives in internal/src/webp.c.
+
+/*
+#include <stdint.h>
+*/
+import "C"
+import (
+	"runtime/cgo"
+)
+
+//export goWebpProgressHook
+func goWebpProgressHook(percent C.int, progress C.uintptr_t) C.int {
+	p := cgo.Handle(progress).Value().(*encodeProgress)
+	if !p.report(int(percent)) {
+		return 0
+	}
+	return 1
+}
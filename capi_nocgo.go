@@ -0,0 +1,353 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !cgo
+
+package gowebp
+
+import (
+	"image"
+	"image/draw"
+
+	xdraw "golang.org/x/image/draw"
+)
+
+// The pure Go versions of the libwebp calls of capi.go. Decoding supports
+// the crop, scaling, flip and upsampling options; the other tuning options
+// are ignored. Encoding is lossless only.
+
+var capabilities = Capabilities{
+	EncodeLossless: true,
+}
+
+func webpGetInfo(data []byte) (width, height int, hasAlpha bool, err error) {
+	if len(data) == 0 {
+		err = newDecodeError("webpGetInfo", VP8StatusNotEnoughData)
+		return
+	}
+	features, err := riffGetFeatures(data)
+	if err != nil {
+		return
+	}
+	return features.Width, features.Height, features.HasAlpha, nil
+}
+
+func webpGetFeatures(data []byte) (features Features, err error) {
+	if len(data) == 0 {
+		err = newDecodeError("webpGetFeatures", VP8StatusNotEnoughData)
+		return
+	}
+	return riffGetFeatures(data)
+}
+
+func webpDecodeGrayInto(data []byte, opt *webpDecoderOptions, pix []byte, width, height, stride int) error {
+	return webpDecodeInto("webpDecodeGrayInto", data, opt, colorModeLuma, pix, width, height, stride)
+}
+
+func webpDecodeRGBInto(data []byte, opt *webpDecoderOptions, pix []byte, width, height, stride int) error {
+	return webpDecodeInto("webpDecodeRGBInto", data, opt, ColorModeRGB, pix, width, height, stride)
+}
+
+// webpDecodeRGBAInto decodes premultiplied RGBA pixels.
+func webpDecodeRGBAInto(data []byte, opt *webpDecoderOptions, pix []byte, width, height, stride int) error {
+	return webpDecodeInto("webpDecodeRGBAInto", data, opt, ColorModergbA, pix, width, height, stride)
+}
+
+// webpDecodeNRGBAInto decodes non-premultiplied RGBA pixels.
+func webpDecodeNRGBAInto(data []byte, opt *webpDecoderOptions, pix []byte, width, height, stride int) error {
+	return webpDecodeInto("webpDecodeNRGBAInto", data, opt, ColorModeRGBA, pix, width, height, stride)
+}
+
+func webpDecodeModeInto(data []byte, opt *webpDecoderOptions, mode ColorMode, pix []byte, width, height, stride int) error {
+	if !mode.valid() {
+		return newDecodeError("webpDecodeModeInto", VP8StatusInvalidParam)
+	}
+	return webpDecodeInto("webpDecodeModeInto", data, opt, mode, pix, width, height, stride)
+}
+
+// colorModeLuma selects the Y plane, as MODE_YUV does for the gray decoding
+// of the cgo build.
+const colorModeLuma ColorMode = -1
+
+// webpDecodeInto decodes data straight into pix, which holds height rows of
+// width pixels, stride bytes apart. The size of the (cropped and scaled)
+// image must match.
+func webpDecodeInto(op string, data []byte, opt *webpDecoderOptions, mode ColorMode, pix []byte, width, height, stride int) error {
+	channels := 1
+	if mode != colorModeLuma {
+		channels = mode.BytesPerPixel()
+	}
+	if len(data) == 0 {
+		return newDecodeError(op, VP8StatusNotEnoughData)
+	}
+	if width <= 0 || height <= 0 || stride < width*channels || len(pix) < (height-1)*stride+width*channels {
+		return newDecodeError(op, VP8StatusInvalidParam)
+	}
+	if opt == nil {
+		opt = &webpDecoderOptions{}
+	}
+
+	src, err := goDecode(data)
+	if err != nil {
+		return goDecodeOpError(op, err)
+	}
+	var m image.Image
+	if mode == colorModeLuma {
+		m = goLuma(src)
+	} else {
+		m = goNRGBA(src, !opt.NoFancyUpsampling)
+	}
+
+	if !opt.Crop.Empty() {
+		if !opt.Crop.In(m.Bounds()) {
+			return newDecodeError(op, VP8StatusInvalidParam)
+		}
+		m = m.(interface {
+			SubImage(r image.Rectangle) image.Image
+		}).SubImage(opt.Crop)
+	}
+	if opt.ScaledWidth != 0 || opt.ScaledHeight != 0 {
+		b := m.Bounds()
+		w, h := scaledSize(b.Dx(), b.Dy(), opt.ScaledWidth, opt.ScaledHeight)
+		if w <= 0 || h <= 0 {
+			return newDecodeError(op, VP8StatusInvalidParam)
+		}
+		var dst draw.Image
+		if mode == colorModeLuma {
+			dst = image.NewGray(image.Rect(0, 0, w, h))
+		} else {
+			dst = image.NewNRGBA(image.Rect(0, 0, w, h))
+		}
+		xdraw.BiLinear.Scale(dst, dst.Bounds(), m, b, draw.Src, nil)
+		m = dst
+	}
+	if b := m.Bounds(); b.Dx() != width || b.Dy() != height {
+		return newDecodeError(op, VP8StatusInvalidParam)
+	}
+
+	for y := 0; y < height; y++ {
+		row := pix[y*stride:][:width*channels]
+		if opt.Flip {
+			row = pix[(height-1-y)*stride:][:width*channels]
+		}
+		switch m := m.(type) {
+		case *image.Gray:
+			copy(row, m.Pix[m.PixOffset(m.Rect.Min.X, m.Rect.Min.Y+y):])
+		case *image.NRGBA:
+			packRow(row, m.Pix[m.PixOffset(m.Rect.Min.X, m.Rect.Min.Y+y):], mode)
+		}
+	}
+	return nil
+}
+
+// goLuma returns the Y plane of a lossy image, or computes it from the RGB
+// of a lossless one as libwebp does.
+func goLuma(m image.Image) *image.Gray {
+	switch m := m.(type) {
+	case *image.YCbCr:
+		return &image.Gray{Pix: m.Y, Stride: m.YStride, Rect: m.Rect}
+	case *image.NYCbCrA:
+		return &image.Gray{Pix: m.Y, Stride: m.YStride, Rect: m.Rect}
+	}
+	p := goNRGBA(m, false)
+	gray := image.NewGray(p.Rect)
+	for i := range gray.Pix {
+		r, g, b := int(p.Pix[4*i+0]), int(p.Pix[4*i+1]), int(p.Pix[4*i+2])
+		gray.Pix[i] = uint8((16839*r + 33059*g + 6420*b + 1<<15 + 16<<16) >> 16)
+	}
+	return gray
+}
+
+// packRow packs the non-premultiplied RGBA pixels of src in mode, as the
+// output of libwebp.
+func packRow(dst, src []byte, mode ColorMode) {
+	n := mode.BytesPerPixel()
+	for i := 0; i < len(dst)/n; i++ {
+		r, g, b, a := src[4*i+0], src[4*i+1], src[4*i+2], src[4*i+3]
+		switch mode {
+		case ColorModergbA, ColorModebgrA, ColorModeArgb:
+			r, g, b, a = premultiply(r, g, b, a)
+		}
+		p := dst[i*n:]
+		switch mode {
+		case ColorModeRGB:
+			p[0], p[1], p[2] = r, g, b
+		case ColorModeBGR:
+			p[0], p[1], p[2] = b, g, r
+		case ColorModeRGBA, ColorModergbA:
+			p[0], p[1], p[2], p[3] = r, g, b, a
+		case ColorModeBGRA, ColorModebgrA:
+			p[0], p[1], p[2], p[3] = b, g, r, a
+		case ColorModeARGB, ColorModeArgb:
+			p[0], p[1], p[2], p[3] = a, r, g, b
+		case ColorModeRGB565:
+			p[0] = r&0xf8 | g>>5
+			p[1] = (g<<3)&0xe0 | b>>3
+		case ColorModeRGBA4444:
+			p[0] = r&0xf0 | g>>4
+			p[1] = b&0xf0 | a>>4
+		case ColorModergbA4444:
+			rg, ba := r&0xf0|g>>4, b&0xf0|a>>4
+			if a4 := ba & 0x0f; a4 != 0x0f {
+				m := uint32(a4) * 0x1111
+				r := uint8(uint32(rg&0xf0|rg>>4) * m >> 16)
+				g := uint8(uint32(rg&0x0f|rg<<4) * m >> 16)
+				b := uint8(uint32(ba&0xf0|ba>>4) * m >> 16)
+				rg, ba = r&0xf0|g>>4&0x0f, b&0xf0|a4
+			}
+			p[0], p[1] = rg, ba
+		}
+	}
+}
+
+// webpDecodeYCbCrInto decodes the raw Y'CbCr planes of data into m, and the
+// alpha plane into a if it is not nil. The chroma of m must be 4:2:0. Only
+// the flip of opt is supported.
+func webpDecodeYCbCrInto(data []byte, opt *webpDecoderOptions, m *image.YCbCr, a []byte, aStride int) error {
+	const op = "webpDecodeYCbCrInto"
+	if len(data) == 0 {
+		return newDecodeError(op, VP8StatusNotEnoughData)
+	}
+	width, height := m.Rect.Dx(), m.Rect.Dy()
+	if width <= 0 || height <= 0 || m.SubsampleRatio != image.YCbCrSubsampleRatio420 {
+		return newDecodeError(op, VP8StatusInvalidParam)
+	}
+	if opt == nil {
+		opt = &webpDecoderOptions{}
+	}
+	if !opt.Crop.Empty() || opt.ScaledWidth != 0 || opt.ScaledHeight != 0 {
+		return newDecodeError(op, VP8StatusUnsupportedFeature)
+	}
+
+	src, err := goDecode(data)
+	if err != nil {
+		return goDecodeOpError(op, err)
+	}
+	var p *image.NYCbCrA
+	switch src := src.(type) {
+	case *image.YCbCr:
+		p = &image.NYCbCrA{YCbCr: *src}
+	case *image.NYCbCrA:
+		p = src
+	default:
+		p = goYCbCr(goNRGBA(src, false))
+	}
+	if p.Rect.Dx() != width || p.Rect.Dy() != height {
+		return newDecodeError(op, VP8StatusInvalidParam)
+	}
+
+	flip := func(y, n int) int {
+		if opt.Flip {
+			return n - 1 - y
+		}
+		return y
+	}
+	for y := 0; y < height; y++ {
+		copy(m.Y[m.YOffset(m.Rect.Min.X, m.Rect.Min.Y+flip(y, height)):][:width], p.Y[y*p.YStride:])
+		if a == nil {
+			continue
+		}
+		row := a[flip(y, height)*aStride:][:width]
+		if p.A == nil {
+			for x := range row {
+				row[x] = 0xff
+			}
+		} else {
+			copy(row, p.A[y*p.AStride:])
+		}
+	}
+	cw, ch := (width+1)/2, (height+1)/2
+	for cy := 0; cy < ch; cy++ {
+		i := m.COffset(m.Rect.Min.X, m.Rect.Min.Y) + flip(cy, ch)*m.CStride
+		copy(m.Cb[i:][:cw], p.Cb[cy*p.CStride:])
+		copy(m.Cr[i:][:cw], p.Cr[cy*p.CStride:])
+	}
+	return nil
+}
+
+// goYCbCr converts the pixels of m to 4:2:0 Y'CbCr in the limited range, as
+// libwebp does for a lossless image.
+func goYCbCr(m *image.NRGBA) *image.NYCbCrA {
+	width, height := m.Rect.Dx(), m.Rect.Dy()
+	p := image.NewNYCbCrA(image.Rect(0, 0, width, height), image.YCbCrSubsampleRatio420)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			s := m.Pix[y*m.Stride+4*x:]
+			r, g, b := int(s[0]), int(s[1]), int(s[2])
+			p.Y[y*p.YStride+x] = uint8((16839*r + 33059*g + 6420*b + 1<<15 + 16<<16) >> 16)
+			p.A[y*p.AStride+x] = s[3]
+		}
+	}
+	for cy := 0; cy < (height+1)/2; cy++ {
+		for cx := 0; cx < (width+1)/2; cx++ {
+			// The sums of a 2x2 block, with the missing pixels of the edges
+			// replaced by their neighbors.
+			var r, g, b int
+			for dy := 0; dy < 2; dy++ {
+				for dx := 0; dx < 2; dx++ {
+					x, y := minInt(2*cx+dx, width-1), minInt(2*cy+dy, height-1)
+					s := m.Pix[y*m.Stride+4*x:]
+					r, g, b = r+int(s[0]), g+int(s[1]), b+int(s[2])
+				}
+			}
+			const rounding = 1<<17 + 128<<18
+			p.Cb[cy*p.CStride+cx] = clampUint8((-9719*r - 19081*g + 28800*b + rounding) >> 18)
+			p.Cr[cy*p.CStride+cx] = clampUint8((28800*r - 24116*g - 4684*b + rounding) >> 18)
+		}
+	}
+	return p
+}
+
+// webpDecodeStatus returns the status of the header of data, or
+// VP8StatusBitstreamError if the header is valid, for the APIs that only
+// report a failure.
+func webpDecodeStatus(data []byte) VP8StatusCode {
+	if _, err := riffGetFeatures(data); err != nil {
+		return err.(*Error).Status
+	}
+	return VP8StatusBitstreamError
+}
+
+func webpDecodeAnimation(data []byte, opt *DecodeOptions) (frames [][]byte, timestamps []int, width, height, loopCount int, bgcolor uint32, err error) {
+	if len(data) == 0 {
+		err = newDecodeError("webpDecodeAnimation", VP8StatusNotEnoughData)
+		return
+	}
+	features, err := riffGetFeatures(data)
+	if err != nil {
+		return
+	}
+	if err = opt.checkAnimationSize(features.Width, features.Height, features.FrameCount); err != nil {
+		return
+	}
+	return goDecodeAnimation(data)
+}
+
+// webpEncodeConfig encodes pix with the pure Go lossless encoder, see
+// goEncodeConfig.
+func webpEncodeConfig(config WebPConfig, pix []byte, width, height, stride, channels int, stats *EncodeStats, progress *encodeProgress) (output []byte, err error) {
+	return goEncodeConfig(config, pix, width, height, stride, channels, stats, progress)
+}
+
+// webpEncodeYCbCr is only reached by lossy encoding, which needs cgo.
+func webpEncodeYCbCr(config WebPConfig, m *image.YCbCr, a []byte, aStride int, stats *EncodeStats, progress *encodeProgress) (output []byte, err error) {
+	err = errLossyEncoding("webpEncodeYCbCr")
+	return
+}
+
+func webpGetMetadata(data []byte, format string) (metadata []byte, err error) {
+	return riffGetMetadata(data, format)
+}
+
+func webpSetMetadata(data, metadata []byte, format string) (newData []byte, err error) {
+	return riffSetMetadata(data, metadata, format)
+}
+
+// goDecodeOpError returns the error of the pure Go decoder for op.
+func goDecodeOpError(op string, err error) error {
+	if e, ok := err.(*Error); ok {
+		return newDecodeError(op, e.Status)
+	}
+	return err
+}
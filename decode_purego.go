@@ -0,0 +1,354 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gowebp
+
+import (
+	"bytes"
+	"image"
+	"image/draw"
+	"io"
+
+	"golang.org/x/image/vp8"
+	"golang.org/x/image/vp8l"
+)
+
+// The pure Go decoder, built on the VP8 and VP8L decoders of
+// golang.org/x/image. It does not use golang.org/x/image/webp, whose
+// image.RegisterFormat would take over the one of this package.
+
+// goDecode decodes a still image to an *image.YCbCr or *image.NYCbCrA if it
+// is lossy, or to an *image.NRGBA if it is lossless.
+func goDecode(data []byte) (m image.Image, err error) {
+	chunks, truncated, err := riffChunks(data)
+	if err != nil {
+		return
+	}
+	if len(chunks) > 0 && chunks[0].id == "VP8X" {
+		if len(chunks[0].data) > 0 && chunks[0].data[0]&vp8xFlagAnimation != 0 {
+			return nil, newDecodeError("goDecode", VP8StatusUnsupportedFeature)
+		}
+		chunks = chunks[1:]
+	}
+	if m, err = goDecodeFrame(chunks); err != nil && truncated {
+		err = newDecodeError("goDecode", VP8StatusNotEnoughData)
+	}
+	return
+}
+
+// goDecodeFrame decodes the image chunks of a still image or of a frame.
+func goDecodeFrame(chunks []riffChunk) (image.Image, error) {
+	var alpha []byte
+	for _, c := range chunks {
+		switch c.id {
+		case "ALPH":
+			alpha = c.data
+		case "VP8 ":
+			d := vp8.NewDecoder()
+			d.Init(bytes.NewReader(c.data), len(c.data))
+			fh, err := d.DecodeFrameHeader()
+			if err != nil {
+				return nil, goDecodeError(err)
+			}
+			m, err := d.DecodeFrame()
+			if err != nil {
+				return nil, goDecodeError(err)
+			}
+			if alpha == nil {
+				return m, nil
+			}
+			a, err := goDecodeAlpha(alpha, fh.Width, fh.Height)
+			if err != nil {
+				return nil, err
+			}
+			return &image.NYCbCrA{YCbCr: *m, A: a, AStride: fh.Width}, nil
+		case "VP8L":
+			m, err := vp8l.Decode(bytes.NewReader(c.data))
+			if err != nil {
+				return nil, goDecodeError(err)
+			}
+			return m, nil
+		}
+	}
+	return nil, newDecodeError("goDecodeFrame", VP8StatusNotEnoughData)
+}
+
+// goDecodeAlpha decodes an ALPH chunk, see
+// https://developers.google.com/speed/webp/docs/riff_container#alpha.
+func goDecodeAlpha(data []byte, width, height int) (a []byte, err error) {
+	if len(data) == 0 {
+		return nil, newDecodeError("goDecodeAlpha", VP8StatusNotEnoughData)
+	}
+	compression, filter := data[0]&0x03, data[0]>>2&0x03
+	switch compression {
+	case 0:
+		if len(data)-1 < width*height {
+			return nil, newDecodeError("goDecodeAlpha", VP8StatusNotEnoughData)
+		}
+		a = append([]byte(nil), data[1:1+width*height]...)
+	case 1:
+		// The alpha is the green channel of a headerless VP8L image.
+		bits := uint32(width-1) | uint32(height-1)<<14
+		header := []byte{vp8lSignature, byte(bits), byte(bits >> 8), byte(bits >> 16), byte(bits >> 24)}
+		m, err := vp8l.Decode(io.MultiReader(bytes.NewReader(header), bytes.NewReader(data[1:])))
+		if err != nil {
+			return nil, goDecodeError(err)
+		}
+		pix := m.(*image.NRGBA).Pix
+		a = make([]byte, width*height)
+		for i := range a {
+			a[i] = pix[4*i+1]
+		}
+	default:
+		return nil, newDecodeError("goDecodeAlpha", VP8StatusBitstreamError)
+	}
+
+	if filter == 0 {
+		return
+	}
+	for y := 0; y < height; y++ {
+		row := a[y*width : (y+1)*width]
+		for x := range row {
+			var pred byte
+			switch {
+			case x == 0 && y == 0:
+			case y == 0:
+				pred = row[x-1]
+			case x == 0:
+				pred = a[(y-1)*width]
+			case filter == 1:
+				pred = row[x-1]
+			case filter == 2:
+				pred = a[(y-1)*width+x]
+			default:
+				v := int(row[x-1]) + int(a[(y-1)*width+x]) - int(a[(y-1)*width+x-1])
+				pred = clampUint8(v)
+			}
+			row[x] += pred
+		}
+	}
+	return
+}
+
+// goDecodeAnimation is the pure Go version of webpDecodeAnimation. The
+// frames are composited with premultiplied alpha on a transparent canvas,
+// with the arithmetic of libwebp.
+func goDecodeAnimation(data []byte) (frames [][]byte, timestamps []int, width, height, loopCount int, bgcolor uint32, err error) {
+	features, err := riffGetFeatures(data)
+	if err != nil {
+		return
+	}
+	width, height = features.Width, features.Height
+	c := features.BackgroundColor
+	loopCount = features.LoopCount
+	bgcolor = uint32(c.A)<<24 | uint32(c.R)<<16 | uint32(c.G)<<8 | uint32(c.B)
+
+	if !features.HasAnimation {
+		var m image.Image
+		if m, err = goDecode(data); err != nil {
+			return
+		}
+		still := []riffFrame{{width: width, height: height}}
+		return goComposite(still, []image.Image{m}, width, height), []int{0}, width, height, loopCount, bgcolor, nil
+	}
+
+	chunks, truncated, err := riffChunks(data)
+	if err != nil {
+		return
+	}
+	if truncated {
+		err = newDecodeError("goDecodeAnimation", VP8StatusNotEnoughData)
+		return
+	}
+	var canvas = image.Rect(0, 0, width, height)
+	var images []image.Image
+	var timestamp int
+	var frameInfos = riffFrames(chunks)
+	for _, frame := range frameInfos {
+		r := image.Rect(frame.x, frame.y, frame.x+frame.width, frame.y+frame.height)
+		if !r.In(canvas) {
+			err = newDecodeError("goDecodeAnimation", VP8StatusBitstreamError)
+			return
+		}
+		var m image.Image
+		if m, err = goDecodeFrame(frame.chunks); err != nil {
+			return
+		}
+		if m.Bounds().Size() != r.Size() {
+			err = newDecodeError("goDecodeAnimation", VP8StatusBitstreamError)
+			return
+		}
+		images = append(images, m)
+		timestamp += frame.duration
+		timestamps = append(timestamps, timestamp)
+	}
+	if len(images) == 0 {
+		err = newDecodeError("goDecodeAnimation", VP8StatusBitstreamError)
+		return
+	}
+	return goComposite(frameInfos, images, width, height), timestamps, width, height, loopCount, bgcolor, nil
+}
+
+// goComposite returns the canvas after each frame, in premultiplied RGBA.
+func goComposite(frames []riffFrame, images []image.Image, width, height int) [][]byte {
+	var canvas = make([]byte, 4*width*height)
+	var disposed image.Rectangle
+	var result [][]byte
+	for i, frame := range frames {
+		for y := disposed.Min.Y; y < disposed.Max.Y; y++ {
+			row := canvas[4*(y*width+disposed.Min.X) : 4*(y*width+disposed.Max.X)]
+			for j := range row {
+				row[j] = 0
+			}
+		}
+
+		m := goNRGBA(images[i], true)
+		for y := 0; y < frame.height; y++ {
+			src := m.Pix[y*m.Stride:][:4*frame.width]
+			dst := canvas[4*((frame.y+y)*width+frame.x):][:4*frame.width]
+			for x := 0; x < len(src); x += 4 {
+				r, g, b, a := premultiply(src[x+0], src[x+1], src[x+2], src[x+3])
+				if frame.blend && a != 0xff {
+					// dst = src + dst*(1-src_alpha), as BlendPixelPremult.
+					scale := 256 - uint32(a)
+					r += uint8(uint32(dst[x+0]) * scale >> 8)
+					g += uint8(uint32(dst[x+1]) * scale >> 8)
+					b += uint8(uint32(dst[x+2]) * scale >> 8)
+					a += uint8(uint32(dst[x+3]) * scale >> 8)
+				}
+				dst[x+0], dst[x+1], dst[x+2], dst[x+3] = r, g, b, a
+			}
+		}
+
+		disposed = image.Rectangle{}
+		if frame.dispose {
+			disposed = image.Rect(frame.x, frame.y, frame.x+frame.width, frame.y+frame.height)
+		}
+		result = append(result, append([]byte(nil), canvas...))
+	}
+	return result
+}
+
+// premultiply returns the color premultiplied by its alpha, as libwebp does.
+func premultiply(r, g, b, a uint8) (uint8, uint8, uint8, uint8) {
+	if a != 0xff {
+		m := uint32(a) * 32897
+		r = uint8(uint32(r) * m >> 23)
+		g = uint8(uint32(g) * m >> 23)
+		b = uint8(uint32(b) * m >> 23)
+	}
+	return r, g, b, a
+}
+
+// goNRGBA returns the pixels of an image returned by goDecode, converting the
+// lossy ones to RGB as libwebp does. Fancy selects the bilinear upsampling of
+// the chroma, instead of repeating each sample.
+func goNRGBA(m image.Image, fancy bool) *image.NRGBA {
+	var p *image.YCbCr
+	var a []byte
+	var aStride int
+	switch m := m.(type) {
+	case *image.NRGBA:
+		return m
+	case *image.YCbCr:
+		p = m
+	case *image.NYCbCrA:
+		p, a, aStride = &m.YCbCr, m.A, m.AStride
+	default:
+		dst := image.NewNRGBA(m.Bounds())
+		draw.Draw(dst, dst.Rect, m, m.Bounds().Min, draw.Src)
+		return dst
+	}
+
+	width, height := p.Rect.Dx(), p.Rect.Dy()
+	dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+	u, v := make([]byte, width), make([]byte, width)
+	lastRow := (height - 1) / 2
+	for y := 0; y < height; y++ {
+		// The nearest chroma row, and the other one of its pair.
+		near, far := y/2, y/2
+		if fancy && y > 0 {
+			if y&1 != 0 {
+				near, far = (y-1)/2, (y+1)/2
+				if far > lastRow {
+					far = lastRow
+				}
+			} else {
+				far = y/2 - 1
+			}
+		}
+		upsampleLine(u, p.Cb[near*p.CStride:], p.Cb[far*p.CStride:], fancy)
+		upsampleLine(v, p.Cr[near*p.CStride:], p.Cr[far*p.CStride:], fancy)
+
+		row := dst.Pix[y*dst.Stride:]
+		for x := 0; x < width; x++ {
+			yy := int(p.Y[y*p.YStride+x])
+			row[4*x+0] = yuvClip(yuvMultHi(yy, 19077) + yuvMultHi(int(v[x]), 26149) - 14234)
+			row[4*x+1] = yuvClip(yuvMultHi(yy, 19077) - yuvMultHi(int(u[x]), 6419) - yuvMultHi(int(v[x]), 13320) + 8708)
+			row[4*x+2] = yuvClip(yuvMultHi(yy, 19077) + yuvMultHi(int(u[x]), 33050) - 17685)
+			row[4*x+3] = 0xff
+			if a != nil {
+				row[4*x+3] = a[y*aStride+x]
+			}
+		}
+	}
+	return dst
+}
+
+// upsampleLine upsamples the chroma of a line from its nearest chroma row
+// and the other one of the pair, like UpsampleRgbaLinePair of libwebp.
+func upsampleLine(dst, near, far []byte, fancy bool) {
+	width := len(dst)
+	if !fancy {
+		for x := range dst {
+			dst[x] = near[x/2]
+		}
+		return
+	}
+	dst[0] = byte((3*int(near[0]) + int(far[0]) + 2) >> 2)
+	last := (width - 1) >> 1
+	for x := 1; x <= last; x++ {
+		tl, t, l, c := int(near[x-1]), int(near[x]), int(far[x-1]), int(far[x])
+		avg := tl + t + l + c + 8
+		diag12 := (avg + 2*(t+l)) >> 3
+		diag03 := (avg + 2*(tl+c)) >> 3
+		dst[2*x-1] = byte((diag12 + tl) >> 1)
+		dst[2*x] = byte((diag03 + t) >> 1)
+	}
+	if width&1 == 0 {
+		dst[width-1] = byte((3*int(near[last]) + int(far[last]) + 2) >> 2)
+	}
+}
+
+func yuvMultHi(v, coeff int) int {
+	return (v * coeff) >> 8
+}
+
+func yuvClip(v int) uint8 {
+	if v&^(256<<6-1) == 0 {
+		return uint8(v >> 6)
+	}
+	if v < 0 {
+		return 0
+	}
+	return 255
+}
+
+// goDecodeError converts an error of the golang.org/x/image decoders.
+func goDecodeError(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return newDecodeError("goDecode", VP8StatusNotEnoughData)
+	}
+	return newDecodeError("goDecode", VP8StatusBitstreamError)
+}
+
+func clampUint8(v int) uint8 {
+	if v < 0 {
+		return 0
+	}
+	if v > 255 {
+		return 255
+	}
+	return uint8(v)
+}
@@ -0,0 +1,67 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gowebp
+
+import (
+	"image"
+)
+
+// goEncodeConfig encodes pix with the pure Go lossless encoder of
+// vp8l_encode.go. Only the Lossless and Exact settings of config apply.
+func goEncodeConfig(config WebPConfig, pix []byte, width, height, stride, channels int, stats *EncodeStats, progress *encodeProgress) (output []byte, err error) {
+	if len(pix) == 0 || width <= 0 || height <= 0 || stride < width*channels {
+		err = newEncodeError("goEncodeConfig", VP8EncErrorBadDimension)
+		return
+	}
+	if len(pix) < (height-1)*stride+width*channels {
+		err = newEncodeError("goEncodeConfig", VP8EncErrorBadDimension)
+		return
+	}
+	if width > WebPMaxDimension || height > WebPMaxDimension {
+		err = newEncodeError("goEncodeConfig", VP8EncErrorBadDimension)
+		return
+	}
+	if config.GetLossless() == 0 {
+		err = errLossyEncoding("goEncodeConfig")
+		return
+	}
+
+	exact := config.GetExact() != 0
+	m := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		src, dst := pix[y*stride:][:width*channels], m.Pix[y*m.Stride:][:4*width]
+		for x := 0; x < width; x++ {
+			switch channels {
+			case 1:
+				v := src[x]
+				dst[4*x+0], dst[4*x+1], dst[4*x+2], dst[4*x+3] = v, v, v, 0xff
+			case 3:
+				dst[4*x+0], dst[4*x+1], dst[4*x+2], dst[4*x+3] = src[3*x+0], src[3*x+1], src[3*x+2], 0xff
+			case 4:
+				copy(dst[4*x:4*x+4], src[4*x:])
+				if !exact && dst[4*x+3] == 0 {
+					// Like libwebp, replace the hidden colors by a prediction
+					// from the neighbors, for a smaller output.
+					switch {
+					case x > 0:
+						copy(dst[4*x:4*x+3], dst[4*x-4:])
+					case y > 0:
+						copy(dst[0:3], m.Pix[(y-1)*m.Stride:])
+					default:
+						dst[0], dst[1], dst[2] = 0, 0, 0
+					}
+				}
+			}
+		}
+	}
+
+	return vp8lEncode(m, stats, progress)
+}
+
+// errLossyEncoding is the error of lossy encoding with the pure Go encoder.
+// It matches VP8EncErrorInvalidConfiguration.
+func errLossyEncoding(op string) error {
+	return newEncodeError(op, VP8EncErrorInvalidConfiguration)
+}
@@ -0,0 +1,144 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gowebp
+
+import (
+	"fmt"
+)
+
+// VP8StatusCode is the status of a libwebp decoding operation. The non-zero
+// codes implement the error interface, and can be tested with errors.Is.
+type VP8StatusCode int
+
+// The values are those of the VP8StatusCode enum of libwebp.
+const (
+	VP8StatusOk                 VP8StatusCode = 0
+	VP8StatusOutOfMemory        VP8StatusCode = 1
+	VP8StatusInvalidParam       VP8StatusCode = 2
+	VP8StatusBitstreamError     VP8StatusCode = 3
+	VP8StatusUnsupportedFeature VP8StatusCode = 4
+	VP8StatusSuspended          VP8StatusCode = 5
+	VP8StatusUserAbort          VP8StatusCode = 6
+	VP8StatusNotEnoughData      VP8StatusCode = 7
+)
+
+var vp8StatusCodeNames = []string{
+	VP8StatusOk:                 "ok",
+	VP8StatusOutOfMemory:        "out of memory",
+	VP8StatusInvalidParam:       "invalid parameter",
+	VP8StatusBitstreamError:     "bitstream error",
+	VP8StatusUnsupportedFeature: "unsupported feature",
+	VP8StatusSuspended:          "suspended, need more data",
+	VP8StatusUserAbort:          "aborted by user",
+	VP8StatusNotEnoughData:      "not enough data",
+}
+
+func (code VP8StatusCode) String() string {
+	if code >= 0 && int(code) < len(vp8StatusCodeNames) {
+		return vp8StatusCodeNames[code]
+	}
+	return fmt.Sprintf("VP8StatusCode(%d)", int(code))
+}
+
+func (code VP8StatusCode) Error() string {
+	return "webp: " + code.String()
+}
+
+// WebPEncodingError is the error code of a libwebp encoding operation. The
+// non-zero codes implement the error interface, and can be tested with
+// errors.Is.
+type WebPEncodingError int
+
+// The values are those of the WebPEncodingError enum of libwebp.
+const (
+	VP8EncOk                        WebPEncodingError = 0
+	VP8EncErrorOutOfMemory          WebPEncodingError = 1  // memory error allocating objects
+	VP8EncErrorBitstreamOutOfMemory WebPEncodingError = 2  // memory error while flushing bits
+	VP8EncErrorNullParameter        WebPEncodingError = 3  // a pointer parameter is NULL
+	VP8EncErrorInvalidConfiguration WebPEncodingError = 4  // configuration is invalid
+	VP8EncErrorBadDimension         WebPEncodingError = 5  // picture has invalid width/height
+	VP8EncErrorPartition0Overflow   WebPEncodingError = 6  // partition is bigger than 512k
+	VP8EncErrorPartitionOverflow    WebPEncodingError = 7  // partition is bigger than 16M
+	VP8EncErrorBadWrite             WebPEncodingError = 8  // error while flushing bytes
+	VP8EncErrorFileTooBig           WebPEncodingError = 9  // file is bigger than 4G
+	VP8EncErrorUserAbort            WebPEncodingError = 10 // abort request by user
+)
+
+var webPEncodingErrorNames = []string{
+	VP8EncOk:                        "ok",
+	VP8EncErrorOutOfMemory:          "out of memory",
+	VP8EncErrorBitstreamOutOfMemory: "out of memory while flushing bits",
+	VP8EncErrorNullParameter:        "null parameter",
+	VP8EncErrorInvalidConfiguration: "invalid configuration",
+	VP8EncErrorBadDimension:         "bad picture dimension",
+	VP8EncErrorPartition0Overflow:   "partition #0 is too big",
+	VP8EncErrorPartitionOverflow:    "partition is too big",
+	VP8EncErrorBadWrite:             "bad write",
+	VP8EncErrorFileTooBig:           "file is too big",
+	VP8EncErrorUserAbort:            "aborted by user",
+}
+
+func (code WebPEncodingError) String() string {
+	if code >= 0 && int(code) < len(webPEncodingErrorNames) {
+		return webPEncodingErrorNames[code]
+	}
+	return fmt.Sprintf("WebPEncodingError(%d)", int(code))
+}
+
+func (code WebPEncodingError) Error() string {
+	return "webp: " + code.String()
+}
+
+// Error is the error returned when libwebp fails to decode or encode an
+// image. It wraps either a VP8StatusCode or a WebPEncodingError:
+//
+//	if errors.Is(err, gowebp.VP8StatusUnsupportedFeature) { ... }
+//
+// Out of memory and user abort conditions of the encoder also match
+// VP8StatusOutOfMemory and VP8StatusUserAbort.
+type Error struct {
+	Op            string            // The failing operation.
+	Status        VP8StatusCode     // Status of a decoding error.
+	EncodingError WebPEncodingError // Error code of an encoding error.
+}
+
+func newDecodeError(op string, status VP8StatusCode) *Error {
+	return &Error{Op: op, Status: status}
+}
+
+func newEncodeError(op string, code WebPEncodingError) *Error {
+	return &Error{Op: op, EncodingError: code}
+}
+
+func (e *Error) Error() string {
+	if e.EncodingError != VP8EncOk {
+		return "webp: " + e.Op + ": " + e.EncodingError.String()
+	}
+	return "webp: " + e.Op + ": " + e.Status.String()
+}
+
+// Unwrap returns the VP8StatusCode or WebPEncodingError of e.
+func (e *Error) Unwrap() error {
+	if e.EncodingError != VP8EncOk {
+		return e.EncodingError
+	}
+	return e.Status
+}
+
+// Is reports whether the encoding error of e is the same condition as the
+// decoding status target.
+func (e *Error) Is(target error) bool {
+	switch target {
+	case VP8StatusOutOfMemory:
+		return e.EncodingError == VP8EncErrorOutOfMemory || e.EncodingError == VP8EncErrorBitstreamOutOfMemory
+	case VP8StatusUserAbort:
+		return e.EncodingError == VP8EncErrorUserAbort
+	}
+	return false
+}
+
+// ErrNeedMoreData is returned by IncrementalDecoder when the data written so
+// far is a valid prefix of a WEBP image, but the image is not complete yet.
+var ErrNeedMoreData error = &Error{Op: "IncrementalDecoder", Status: VP8StatusSuspended}
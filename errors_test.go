@@ -0,0 +1,58 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gowebp
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"io/ioutil"
+	"testing"
+)
+
+func TestError_decode(t *testing.T) {
+	data, err := ioutil.ReadFile(testdataDir + "1_webp_ll.webp")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Corrupt the VP8L payload, but keep the header intact.
+	corrupt := append([]byte(nil), data...)
+	for i := 64; i < len(corrupt); i++ {
+		corrupt[i] ^= 0x5a
+	}
+	_, _, _, err = webpDecodeRGBA(corrupt, nil)
+	tAssert(t, errors.Is(err, VP8StatusBitstreamError), err)
+
+	var e *Error
+	tAssert(t, errors.As(err, &e))
+	tAssertEQ(t, VP8StatusBitstreamError, e.Status)
+
+	_, _, _, err = webpDecodeRGBA(data[:len(data)/2], nil)
+	tAssert(t, errors.Is(err, VP8StatusNotEnoughData), err)
+
+	_, _, _, err = webpDecodeRGBA([]byte("not a webp image"), nil)
+	tAssertNotNil(t, err)
+	tAssertFalse(t, errors.Is(err, VP8StatusOk))
+
+	_, err = DecodeRGBA(nil)
+	tAssert(t, errors.Is(err, VP8StatusNotEnoughData), err)
+}
+
+func TestError_encode(t *testing.T) {
+	m := image.NewRGBA(image.Rect(0, 0, 1<<15, 1))
+	_, err := EncodeRGBA(m, 90)
+	tAssert(t, errors.Is(err, VP8EncErrorBadDimension), err)
+
+	err = Encode(new(bytes.Buffer), image.NewRGBA(image.Rect(0, 0, 8, 8)), &Options{Quality: 101})
+	tAssert(t, errors.Is(err, VP8EncErrorInvalidConfiguration), err)
+}
+
+func TestError_is(t *testing.T) {
+	tAssert(t, errors.Is(newEncodeError("op", VP8EncErrorOutOfMemory), VP8StatusOutOfMemory))
+	tAssert(t, errors.Is(newEncodeError("op", VP8EncErrorUserAbort), VP8StatusUserAbort))
+	tAssertFalse(t, errors.Is(newEncodeError("op", VP8EncErrorBadWrite), VP8StatusUserAbort))
+	tAssertEQ(t, "webp: WebPDecode: bitstream error", newDecodeError("WebPDecode", VP8StatusBitstreamError).Error())
+}
@@ -0,0 +1,67 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gowebp
+
+import (
+	"image/color"
+)
+
+// Format is the compression format of a WEBP image.
+type Format int
+
+const (
+	FormatUnknown  Format = iota // The format could not be determined.
+	FormatLossy                  // VP8 frames.
+	FormatLossless               // VP8L frames.
+	FormatMixed                  // An animation with both VP8 and VP8L frames.
+)
+
+var formatNames = []string{
+	FormatUnknown:  "unknown",
+	FormatLossy:    "lossy",
+	FormatLossless: "lossless",
+	FormatMixed:    "mixed",
+}
+
+func (f Format) String() string {
+	if f >= 0 && int(f) < len(formatNames) {
+		return formatNames[f]
+	}
+	return "unknown"
+}
+
+// Features describes a WEBP image as found in its headers, without decoding
+// it. See GetFeatures.
+type Features struct {
+	Width, Height           int // The canvas size.
+	FrameWidth, FrameHeight int // The size of the first frame.
+
+	Format       Format
+	HasAlpha     bool
+	HasAnimation bool
+
+	// The VP8X flags for the metadata chunks.
+	HasICC  bool
+	HasEXIF bool
+	HasXMP  bool
+
+	// FrameCount is the number of frames found in the data, 1 for a still
+	// image.
+	FrameCount int
+	// LoopCount is the number of times an animation is played, 0 means to
+	// loop forever.
+	LoopCount int
+	// BackgroundColor is the canvas background color hint of an animation.
+	BackgroundColor color.NRGBA
+}
+
+// The VP8X flags, see WebPFeatureFlags of libwebp.
+const (
+	vp8xFlagAnimation = 0x02
+	vp8xFlagXMP       = 0x04
+	vp8xFlagEXIF      = 0x08
+	vp8xFlagAlpha     = 0x10
+	vp8xFlagICC       = 0x20
+)
@@ -0,0 +1,65 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gowebp
+
+import (
+	"io/ioutil"
+	"testing"
+)
+
+func TestGetFeatures(t *testing.T) {
+	for i, v := range []struct {
+		filename string
+		format   Format
+		hasAlpha bool
+	}{
+		{"video-001.webp", FormatLossy, false},
+		{"1_webp_a.webp", FormatLossy, true},
+		{"1_webp_ll.webp", FormatLossless, true},
+		{"tux.lossless.webp", FormatLossless, true},
+	} {
+		data, err := ioutil.ReadFile(testdataDir + v.filename)
+		if err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		width, height, _, err := GetInfo(data)
+		if err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+
+		f, err := GetFeatures(data)
+		if err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		tAssertEQ(t, v.format, f.Format, i)
+		tAssertEQ(t, v.hasAlpha, f.HasAlpha, i)
+		tAssertFalse(t, f.HasAnimation, i)
+		tAssertEQ(t, 1, f.FrameCount, i)
+		tAssertEQ(t, width, f.Width, i)
+		tAssertEQ(t, height, f.Height, i)
+		tAssertEQ(t, width, f.FrameWidth, i)
+		tAssertEQ(t, height, f.FrameHeight, i)
+	}
+}
+
+func TestGetFeatures_metadata(t *testing.T) {
+	data, err := ioutil.ReadFile(testdataDir + "video-001.webp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err = SetMetadata(data, []byte("Exif\x00\x00"), "EXIF")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := GetFeatures(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tAssert(t, f.HasEXIF)
+	tAssertFalse(t, f.HasICC)
+	tAssertFalse(t, f.HasXMP)
+	tAssertEQ(t, FormatLossy, f.Format)
+}
@@ -7,19 +7,17 @@ package fuzz
 
 import (
 	"bytes"
+	"context"
 
 	"github.com/iwind/gowebp"
 )
 
 func Fuzz(data []byte) int {
-	cfg, err := gowebp.DecodeConfig(bytes.NewReader(data))
-	if err != nil {
-		return 0
-	}
-	if cfg.Width*cfg.Height > 1e6 {
-		return 0
-	}
-	if _, err := gowebp.Decode(bytes.NewReader(data)); err != nil {
+	opt := &gowebp.DecodeOptions{MaxPixels: 1e6}
+	_, errRGBA := gowebp.DecodeRGBAWithOptions(data, opt)
+	_, errNRGBA := gowebp.DecodeNRGBAWithOptions(data, opt)
+	_, errContext := gowebp.DecodeContext(context.Background(), bytes.NewReader(data), opt)
+	if errRGBA != nil && errNRGBA != nil && errContext != nil {
 		return 0
 	}
 	return 1
@@ -48,6 +48,8 @@ type MemPImage struct {
 	XDataType  reflect.Kind
 	XPix       PixSlice
 	XStride    int
+
+	mode ColorMode // The layout of the pixels, if decoded by DecodeMode.
 }
 
 func NewMemPImage(r image.Rectangle, channels int, dataType reflect.Kind) *MemPImage {
@@ -303,6 +305,7 @@ func (p *MemPImage) SubImage(r image.Rectangle) image.Image {
 		XDataType: p.XDataType,
 		XPix:      p.XPix[i:],
 		XStride:   p.XStride,
+		mode:      p.mode,
 	}
 }
 
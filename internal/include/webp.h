@@ -8,6 +8,7 @@
 #include <stddef.h>
 #include <stdint.h>
 #include <webp/decode.h>
+#include <webp/encode.h>
 
 #ifdef __cplusplus
 extern "C" {
@@ -32,6 +33,33 @@ uint8_t* webpDecodeRGBA(
 	int* width, int* height
 );
 
+int webpDecodeInto(
+	const uint8_t* data, size_t data_size,
+	const WebPDecoderOptions* options, int colorspace,
+	uint8_t* out, int width, int height, int stride, size_t out_size
+);
+
+int webpDecodeYUVAInto(
+	const uint8_t* data, size_t data_size,
+	const WebPDecoderOptions* options,
+	uint8_t* y, int y_stride, size_t y_size,
+	uint8_t* u, uint8_t* v, int uv_stride, size_t uv_size,
+	uint8_t* a, int a_stride, size_t a_size,
+	int width, int height
+);
+
+typedef struct {
+	int canvas_width, canvas_height;
+	int frame_width, frame_height; // of the first frame
+	int has_alpha, has_animation;
+	int format; // 0: unknown, 1: lossy, 2: lossless, 3: mixed
+	uint32_t flags; // VP8X flags
+	int frame_count, loop_count;
+	uint32_t bgcolor;
+} webpFeatures;
+
+int webpGetFeatures(const uint8_t* data, size_t data_size, webpFeatures* features);
+
 int webpDecodeGrayToSize(const uint8_t* data, size_t data_size,
 	int width, int height, int outStride, uint8_t* out
 );
@@ -68,6 +96,22 @@ uint8_t* webpEncodeLosslessRGBA(
 	size_t* output_size
 );
 
+uint8_t* webpEncodeConfig(
+	const WebPConfig* config,
+	const uint8_t* pix, int width, int height, int stride, int channels,
+	WebPAuxStats* stats, uintptr_t progress,
+	size_t* output_size, int* error_code
+);
+uint8_t* webpEncodeYUVA(
+	const WebPConfig* config,
+	const uint8_t* y, int y_stride,
+	const uint8_t* u, const uint8_t* v, int uv_stride,
+	const uint8_t* a, int a_stride,
+	int width, int height,
+	WebPAuxStats* stats, uintptr_t progress,
+	size_t* output_size, int* error_code
+);
+
 char* webpGetEXIF(const uint8_t* data, size_t data_size, size_t* metadata_size);
 char* webpGetICCP(const uint8_t* data, size_t data_size, size_t* metadata_size);
 char* webpGetXMP(const uint8_t* data, size_t data_size, size_t* metadata_size);
@@ -88,6 +88,145 @@ uint8_t* webpDecodeRGBA(
 	return WebPDecodeRGBA(data, data_size, width, height);
 }
 
+int webpDecodeInto(
+	const uint8_t* data, size_t data_size,
+	const WebPDecoderOptions* options, int colorspace,
+	uint8_t* out, int width, int height, int stride, size_t out_size
+) {
+	WebPDecoderConfig config;
+	WebPYUVABuffer* yuva;
+	uint8_t* uv = NULL;
+	VP8StatusCode status;
+
+	if(!WebPInitDecoderConfig(&config)) {
+		return VP8_STATUS_INVALID_PARAM;
+	}
+	if(options != NULL) {
+		config.options = *options;
+	}
+
+	config.output.colorspace = (WEBP_CSP_MODE)colorspace;
+	config.output.is_external_memory = 1;
+	if(WebPIsRGBMode(config.output.colorspace)) {
+		config.output.u.RGBA.rgba = out;
+		config.output.u.RGBA.stride = stride;
+		config.output.u.RGBA.size = out_size;
+	} else {
+		// Only the Y plane is wanted, U/V go to a scratch buffer.
+		yuva = &config.output.u.YUVA;
+		yuva->y = out;
+		yuva->y_stride = stride;
+		yuva->y_size = out_size;
+		yuva->u_stride = yuva->v_stride = (width + 1) / 2;
+		yuva->u_size = yuva->v_size = (size_t)yuva->u_stride * ((height + 1) / 2);
+		if((uv = (uint8_t*)malloc(2 * yuva->u_size)) == NULL) {
+			return VP8_STATUS_OUT_OF_MEMORY;
+		}
+		yuva->u = uv;
+		yuva->v = uv + yuva->u_size;
+	}
+
+	status = WebPDecode(data, data_size, &config);
+	if(status == VP8_STATUS_OK && (config.output.width != width || config.output.height != height)) {
+		status = VP8_STATUS_INVALID_PARAM;
+	}
+	WebPFreeDecBuffer(&config.output);
+	free(uv);
+	return status;
+}
+
+int webpDecodeYUVAInto(
+	const uint8_t* data, size_t data_size,
+	const WebPDecoderOptions* options,
+	uint8_t* y, int y_stride, size_t y_size,
+	uint8_t* u, uint8_t* v, int uv_stride, size_t uv_size,
+	uint8_t* a, int a_stride, size_t a_size,
+	int width, int height
+) {
+	WebPDecoderConfig config;
+	WebPYUVABuffer* yuva = &config.output.u.YUVA;
+	VP8StatusCode status;
+
+	if(!WebPInitDecoderConfig(&config)) {
+		return VP8_STATUS_INVALID_PARAM;
+	}
+	if(options != NULL) {
+		config.options = *options;
+	}
+
+	config.output.colorspace = (a != NULL) ? MODE_YUVA : MODE_YUV;
+	config.output.is_external_memory = 1;
+	yuva->y = y;
+	yuva->y_stride = y_stride;
+	yuva->y_size = y_size;
+	yuva->u = u;
+	yuva->v = v;
+	yuva->u_stride = yuva->v_stride = uv_stride;
+	yuva->u_size = yuva->v_size = uv_size;
+	yuva->a = a;
+	yuva->a_stride = a_stride;
+	yuva->a_size = a_size;
+
+	status = WebPDecode(data, data_size, &config);
+	if(status == VP8_STATUS_OK && (config.output.width != width || config.output.height != height)) {
+		status = VP8_STATUS_INVALID_PARAM;
+	}
+	WebPFreeDecBuffer(&config.output);
+	return status;
+}
+
+int webpGetFeatures(const uint8_t* data, size_t data_size, webpFeatures* features) {
+	WebPBitstreamFeatures bf;
+	WebPData webp_data;
+	WebPDemuxer* demux;
+	WebPDemuxState state;
+	WebPIterator iter;
+	VP8StatusCode status;
+
+	memset(features, 0, sizeof(*features));
+	if ((status = WebPGetFeatures(data, data_size, &bf)) != VP8_STATUS_OK) {
+		return status;
+	}
+	features->canvas_width = features->frame_width = bf.width;
+	features->canvas_height = features->frame_height = bf.height;
+	features->has_alpha = bf.has_alpha;
+	features->has_animation = bf.has_animation;
+	features->format = bf.format;
+
+	webp_data.bytes = data;
+	webp_data.size = data_size;
+	if ((demux = WebPDemuxPartial(&webp_data, &state)) == NULL) {
+		// The header is valid, but the chunks are not.
+		return VP8_STATUS_BITSTREAM_ERROR;
+	}
+	features->canvas_width = WebPDemuxGetI(demux, WEBP_FF_CANVAS_WIDTH);
+	features->canvas_height = WebPDemuxGetI(demux, WEBP_FF_CANVAS_HEIGHT);
+	features->flags = WebPDemuxGetI(demux, WEBP_FF_FORMAT_FLAGS);
+	features->frame_count = WebPDemuxGetI(demux, WEBP_FF_FRAME_COUNT);
+	features->loop_count = WebPDemuxGetI(demux, WEBP_FF_LOOP_COUNT);
+	features->bgcolor = WebPDemuxGetI(demux, WEBP_FF_BACKGROUND_COLOR);
+
+	if (WebPDemuxGetFrame(demux, 1, &iter)) {
+		features->frame_width = iter.width;
+		features->frame_height = iter.height;
+		features->format = 0;
+		do {
+			if (WebPGetFeatures(iter.fragment.bytes, iter.fragment.size, &bf) != VP8_STATUS_OK) {
+				continue;
+			}
+			if (features->format == 0) {
+				features->format = bf.format;
+			} else if (features->format != bf.format) {
+				features->format = 3;
+			}
+		} while (WebPDemuxNextFrame(&iter));
+		WebPDemuxReleaseIterator(&iter);
+	}
+
+	WebPDemuxDelete(demux);
+	return VP8_STATUS_OK;
+}
+
 int webpDecodeGrayToSize(const uint8_t* data, size_t data_size,
 	int width, int height, int outStride, uint8_t* out
 ) {
@@ -287,6 +426,169 @@ uint8_t* webpEncodeLosslessRGBA(
 	return wrt.mem;
 }
 
+// Implemented in Go, see capi_hook.go.
+extern int goWebpProgressHook(int percent, uintptr_t progress);
+
+static int webpProgressHook(int percent, const WebPPicture* picture) {
+	return goWebpProgressHook(percent, (uintptr_t)picture->user_data);
+}
+
+// webpEncodePicture encodes pic with config, and frees pic.
+static uint8_t* webpEncodePicture(
+	const WebPConfig* config, WebPPicture* pic, int ok,
+	WebPAuxStats* stats, uintptr_t progress,
+	size_t* output_size, int* error_code
+) {
+	WebPMemoryWriter wrt;
+
+	pic->stats = stats;
+	if (progress != 0) {
+		pic->progress_hook = webpProgressHook;
+		pic->user_data = (void*)progress;
+	}
+
+	pic->writer = WebPMemoryWrite;
+	pic->custom_ptr = &wrt;
+	WebPMemoryWriterInit(&wrt);
+
+	ok = ok && WebPEncode(config, pic);
+	*error_code = pic->error_code;
+
+	WebPPictureFree(pic);
+	if (!ok) {
+		WebPMemoryWriterClear(&wrt);
+		return NULL;
+	}
+	*output_size = wrt.size;
+
+	return wrt.mem;
+}
+
+uint8_t* webpEncodeConfig(
+	const WebPConfig* config,
+	const uint8_t* pix, int width, int height, int stride, int channels,
+	WebPAuxStats* stats, uintptr_t progress,
+	size_t* output_size, int* error_code
+) {
+	WebPPicture pic;
+	uint8_t* rgb = NULL;
+	uint8_t* output;
+	int x, y;
+	int ok;
+
+	*output_size = 0;
+	*error_code = VP8_ENC_OK;
+	if (!WebPPictureInit(&pic)) {
+		*error_code = VP8_ENC_ERROR_INVALID_CONFIGURATION;
+		return NULL;
+	}
+
+	// Keep ARGB input, so that WebPEncode() does the RGB to YUV conversion
+	// and honors config->use_sharp_yuv.
+	pic.use_argb = 1;
+	pic.width = width;
+	pic.height = height;
+
+	switch(channels) {
+	case 1:
+		if((rgb = (uint8_t*)malloc(width*height*3)) == NULL) {
+			*error_code = VP8_ENC_ERROR_OUT_OF_MEMORY;
+			return NULL;
+		}
+		for(y = 0; y < height; ++y) {
+			const uint8_t* src = pix + y*stride;
+			uint8_t* dst = rgb + y*width*3;
+			for(x = 0; x < width; ++x) {
+				uint8_t v = *src++;
+				*dst++ = v;
+				*dst++ = v;
+				*dst++ = v;
+			}
+		}
+		ok = WebPPictureImportRGB(&pic, rgb, width*3);
+		break;
+	case 3:
+		ok = WebPPictureImportRGB(&pic, pix, stride);
+		break;
+	case 4:
+		ok = WebPPictureImportRGBA(&pic, pix, stride);
+		break;
+	default:
+		ok = WebPEncodingSetError(&pic, VP8_ENC_ERROR_INVALID_CONFIGURATION);
+		break;
+	}
+
+	output = webpEncodePicture(config, &pic, ok, stats, progress, output_size, error_code);
+	free(rgb);
+	return output;
+}
+
+// webpCopyPlane copies the rows of a plane through the lookup table lut.
+static void webpCopyPlane(
+	const uint8_t* src, int src_stride, uint8_t* dst, int dst_stride,
+	int width, int height, const uint8_t* lut
+) {
+	int x, y;
+	for(y = 0; y < height; ++y) {
+		if(lut == NULL) {
+			memcpy(dst, src, width);
+		} else {
+			for(x = 0; x < width; ++x) {
+				dst[x] = lut[src[x]];
+			}
+		}
+		src += src_stride;
+		dst += dst_stride;
+	}
+}
+
+uint8_t* webpEncodeYUVA(
+	const WebPConfig* config,
+	const uint8_t* y, int y_stride,
+	const uint8_t* u, const uint8_t* v, int uv_stride,
+	const uint8_t* a, int a_stride,
+	int width, int height,
+	WebPAuxStats* stats, uintptr_t progress,
+	size_t* output_size, int* error_code
+) {
+	WebPPicture pic;
+	uint8_t y_lut[256], uv_lut[256];
+	int i, ok;
+
+	*output_size = 0;
+	*error_code = VP8_ENC_OK;
+	if (!WebPPictureInit(&pic)) {
+		*error_code = VP8_ENC_ERROR_INVALID_CONFIGURATION;
+		return NULL;
+	}
+
+	pic.use_argb = 0;
+	pic.colorspace = (a != NULL) ? WEBP_YUV420A : WEBP_YUV420;
+	pic.width = width;
+	pic.height = height;
+	if (!WebPPictureAlloc(&pic)) {
+		*error_code = pic.error_code;
+		WebPPictureFree(&pic);
+		return NULL;
+	}
+
+	// The input is in the full range of JFIF, while the samples of VP8 are
+	// in the limited range of BT.601.
+	for (i = 0; i < 256; ++i) {
+		y_lut[i] = (uint8_t)(16 + (i * 219 + 127) / 255);
+		uv_lut[i] = (uint8_t)(16 + (i * 224 + 127) / 255);
+	}
+	webpCopyPlane(y, y_stride, pic.y, pic.y_stride, width, height, y_lut);
+	webpCopyPlane(u, uv_stride, pic.u, pic.uv_stride, (width + 1) / 2, (height + 1) / 2, uv_lut);
+	webpCopyPlane(v, uv_stride, pic.v, pic.uv_stride, (width + 1) / 2, (height + 1) / 2, uv_lut);
+	if (a != NULL) {
+		webpCopyPlane(a, a_stride, pic.a, pic.a_stride, width, height, NULL);
+	}
+
+	ok = 1;
+	return webpEncodePicture(config, &pic, ok, stats, progress, output_size, error_code);
+}
+
 char* webpGetEXIF(const uint8_t* data, size_t data_size, size_t* metadata_size) {
 	char* metadata = NULL;
 	WebPData webp_data = {data, data_size};
@@ -0,0 +1,122 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gowebp
+
+import (
+	"fmt"
+	"image"
+)
+
+// ColorMode is the pixel layout produced by DecodeMode. The values are those
+// of the WEBP_CSP_MODE enum of libwebp.
+type ColorMode int
+
+const (
+	ColorModeRGB       ColorMode = 0
+	ColorModeRGBA      ColorMode = 1
+	ColorModeBGR       ColorMode = 2
+	ColorModeBGRA      ColorMode = 3
+	ColorModeARGB      ColorMode = 4
+	ColorModeRGBA4444  ColorMode = 5
+	ColorModeRGB565    ColorMode = 6
+	ColorModergbA      ColorMode = 7  // RGBA with premultiplied alpha.
+	ColorModebgrA      ColorMode = 8  // BGRA with premultiplied alpha.
+	ColorModeArgb      ColorMode = 9  // ARGB with premultiplied alpha.
+	ColorModergbA4444  ColorMode = 10 // RGBA4444 with premultiplied alpha.
+	colorModeLastValid ColorMode = ColorModergbA4444
+)
+
+var colorModeNames = []string{
+	ColorModeRGB:      "RGB",
+	ColorModeRGBA:     "RGBA",
+	ColorModeBGR:      "BGR",
+	ColorModeBGRA:     "BGRA",
+	ColorModeARGB:     "ARGB",
+	ColorModeRGBA4444: "RGBA4444",
+	ColorModeRGB565:   "RGB565",
+	ColorModergbA:     "rgbA",
+	ColorModebgrA:     "bgrA",
+	ColorModeArgb:     "Argb",
+	ColorModergbA4444: "rgbA4444",
+}
+
+func (mode ColorMode) String() string {
+	if mode.valid() {
+		return colorModeNames[mode]
+	}
+	return fmt.Sprintf("ColorMode(%d)", int(mode))
+}
+
+func (mode ColorMode) valid() bool {
+	return mode >= ColorModeRGB && mode <= colorModeLastValid
+}
+
+// BytesPerPixel returns the size of a pixel in mode. The 16 bits modes pack
+// a pixel in 2 bytes, in the byte order of libwebp.
+func (mode ColorMode) BytesPerPixel() int {
+	switch mode {
+	case ColorModeRGB, ColorModeBGR:
+		return 3
+	case ColorModeRGBA4444, ColorModeRGB565, ColorModergbA4444:
+		return 2
+	case ColorModeRGBA, ColorModeBGRA, ColorModeARGB, ColorModergbA, ColorModebgrA, ColorModeArgb:
+		return 4
+	}
+	return 0
+}
+
+// reordered reports whether the pixels of mode are not the plain RGB or
+// straight RGBA of their number of channels, and need toNRGBA to be encoded.
+func (mode ColorMode) reordered() bool {
+	return mode != ColorModeRGB && mode != ColorModeRGBA && mode.valid()
+}
+
+// toNRGBA converts the pixels of p, decoded in mode, to straight RGBA.
+func (mode ColorMode) toNRGBA(p *MemPImage) *image.NRGBA {
+	b := p.XRect
+	n := mode.BytesPerPixel()
+	dst := image.NewNRGBA(b)
+	for y := 0; y < b.Dy(); y++ {
+		src, row := p.XPix[y*p.XStride:][:n*b.Dx()], dst.Pix[y*dst.Stride:][:4*b.Dx()]
+		for x := 0; x < b.Dx(); x++ {
+			s, d := src[n*x:][:n], row[4*x:][:4]
+			switch mode {
+			case ColorModeRGB:
+				d[0], d[1], d[2], d[3] = s[0], s[1], s[2], 0xff
+			case ColorModeRGBA, ColorModergbA:
+				d[0], d[1], d[2], d[3] = s[0], s[1], s[2], s[3]
+			case ColorModeBGR:
+				d[0], d[1], d[2], d[3] = s[2], s[1], s[0], 0xff
+			case ColorModeBGRA, ColorModebgrA:
+				d[0], d[1], d[2], d[3] = s[2], s[1], s[0], s[3]
+			case ColorModeARGB, ColorModeArgb:
+				d[0], d[1], d[2], d[3] = s[1], s[2], s[3], s[0]
+			case ColorModeRGBA4444, ColorModergbA4444:
+				// rrrrgggg bbbbaaaa
+				d[0], d[1], d[2], d[3] = s[0]>>4*0x11, s[0]&0xf*0x11, s[1]>>4*0x11, s[1]&0xf*0x11
+			case ColorModeRGB565:
+				// rrrrrggg gggbbbbb
+				r, g, b := s[0]&0xf8, s[0]<<5|s[1]>>3&0x1c, s[1]<<3
+				d[0], d[1], d[2], d[3] = r|r>>5, g|g>>6, b|b>>5, 0xff
+			}
+			if mode.premultiplied() && d[3] != 0xff {
+				for i, v := range d[:3] {
+					if d[3] == 0 {
+						d[i] = 0
+					} else {
+						d[i] = uint8(minInt((int(v)*0xff+int(d[3])/2)/int(d[3]), 0xff))
+					}
+				}
+			}
+		}
+	}
+	return dst
+}
+
+// premultiplied reports whether the colors of mode are premultiplied by
+// the alpha.
+func (mode ColorMode) premultiplied() bool {
+	return mode >= ColorModergbA && mode <= ColorModergbA4444
+}
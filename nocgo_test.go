@@ -0,0 +1,78 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !cgo
+
+package gowebp
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"io/ioutil"
+	"testing"
+)
+
+func TestGetCapabilities_nocgo(t *testing.T) {
+	tAssertEQ(t, Capabilities{EncodeLossless: true}, GetCapabilities())
+}
+
+func TestEncode_nocgo(t *testing.T) {
+	img0, err := loadImage("1_webp_ll.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = Encode(new(bytes.Buffer), img0, &Options{Quality: 90})
+	tAssert(t, errors.Is(err, VP8EncErrorInvalidConfiguration), err)
+	_, err = EncodeRGBA(img0, 90)
+	tAssert(t, errors.Is(err, VP8EncErrorInvalidConfiguration), err)
+
+	buf := new(bytes.Buffer)
+	if err := Encode(buf, img0, &Options{Lossless: true, Exact: true}); err != nil {
+		t.Fatal(err)
+	}
+	img1, format, err := image.Decode(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tAssertEQ(t, "webp", format)
+	if got := averageDeltaNRGBA(img0, img1); got != 0 {
+		t.Fatalf("average delta too high; got %d, want 0", got)
+	}
+}
+
+func TestIncrementalDecoder_nocgo(t *testing.T) {
+	data, err := ioutil.ReadFile(testdataDir + "video-001.webp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := NewIncrementalDecoder()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+
+	if _, err := d.Write(data[:len(data)/2]); err != nil {
+		t.Fatal(err)
+	}
+	tAssert(t, d.NeedMoreData())
+	m, lastY := d.Image()
+	tAssertNotNil(t, m)
+	tAssertEQ(t, 0, lastY)
+
+	if _, err := d.Write(data[len(data)/2:]); err != nil {
+		t.Fatal(err)
+	}
+	tAssert(t, d.Done())
+	m, err = d.Finish()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := DecodeRGBA(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tAssert(t, bytes.Equal(want.Pix, m.Pix))
+}
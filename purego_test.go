@@ -0,0 +1,256 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build cgo
+
+package gowebp
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"io/ioutil"
+	"math/rand"
+	"testing"
+)
+
+// The tests below check the pure Go fallback against libwebp.
+
+var tPureGoFiles = []string{
+	"1_webp_a.webp",
+	"1_webp_ll.webp",
+	"4_webp_a.webp",
+	"blue-purple-pink-large.normal-filter.lossy.webp",
+	"gopher-doc.2bpp.lossless.webp",
+	"tux.lossless.webp",
+	"video-001.webp",
+	"yellow_rose.lossy-with-alpha.webp",
+	"yellow_rose.lossy.webp",
+}
+
+func TestPureGo_getFeatures(t *testing.T) {
+	for _, filename := range tPureGoFiles {
+		data, err := ioutil.ReadFile(testdataDir + filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, err := webpGetFeatures(data)
+		if err != nil {
+			t.Fatalf("%s: %v", filename, err)
+		}
+		got, err := riffGetFeatures(data)
+		if err != nil {
+			t.Fatalf("%s: %v", filename, err)
+		}
+		tAssertEQ(t, want, got, filename)
+
+		// The header is enough for GetInfo.
+		got, err = riffGetFeatures(data[:maxWebpHeaderSize])
+		if err != nil {
+			t.Fatalf("%s: %v", filename, err)
+		}
+		tAssertEQ(t, want.Width, got.Width, filename)
+		tAssertEQ(t, want.Height, got.Height, filename)
+		tAssertEQ(t, want.HasAlpha, got.HasAlpha, filename)
+	}
+
+	data := newTestAnimation(t, 3)
+	want, err := webpGetFeatures(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := riffGetFeatures(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tAssertEQ(t, want, got)
+
+	_, err = riffGetFeatures([]byte("RIFF\x10\x00\x00\x00WAVEfmt "))
+	tAssertNotNil(t, err)
+}
+
+func TestPureGo_decode(t *testing.T) {
+	for _, filename := range tPureGoFiles {
+		data, err := ioutil.ReadFile(testdataDir + filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, err := DecodeNRGBA(data)
+		if err != nil {
+			t.Fatalf("%s: %v", filename, err)
+		}
+		m, err := goDecode(data)
+		if err != nil {
+			t.Fatalf("%s: %v", filename, err)
+		}
+		got := goNRGBA(m, true)
+		tAssertEQ(t, want.Rect, got.Rect, filename)
+		tAssert(t, bytes.Equal(want.Pix, got.Pix), filename)
+
+		_, err = goDecode(data[:len(data)/2])
+		tAssertNotNil(t, err, filename)
+	}
+}
+
+func TestPureGo_decodeAnimation(t *testing.T) {
+	data := newTestAnimation(t, 3)
+	frames, timestamps, width, height, loopCount, bgcolor, err := webpDecodeAnimation(data, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	goFrames, goTimestamps, goWidth, goHeight, goLoopCount, goBgcolor, err := goDecodeAnimation(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tAssertEQ(t, width, goWidth)
+	tAssertEQ(t, height, goHeight)
+	tAssertEQ(t, loopCount, goLoopCount)
+	tAssertEQ(t, bgcolor, goBgcolor)
+	tAssertEQ(t, timestamps, goTimestamps)
+	tAssertEQ(t, len(frames), len(goFrames))
+	for i := range frames {
+		tAssert(t, bytes.Equal(frames[i], goFrames[i]), i)
+	}
+
+	// A still image is a single frame.
+	still, err := ioutil.ReadFile(testdataDir + "1_webp_ll.webp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	frames, timestamps, _, _, loopCount, bgcolor, err = webpDecodeAnimation(still, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	goFrames, goTimestamps, _, _, goLoopCount, goBgcolor, err = goDecodeAnimation(still)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tAssertEQ(t, timestamps, goTimestamps)
+	tAssertEQ(t, loopCount, goLoopCount)
+	tAssertEQ(t, bgcolor, goBgcolor)
+	tAssert(t, bytes.Equal(frames[0], goFrames[0]))
+}
+
+func TestPureGo_metadata(t *testing.T) {
+	data, err := ioutil.ReadFile(testdataDir + "1_webp_a.webp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, format := range []string{"EXIF", "ICCP", "XMP"} {
+		metadata := []byte("metadata of " + format)
+
+		// Set by Go, read by libwebp.
+		newData, err := riffSetMetadata(data, metadata, format)
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		got, err := webpGetMetadata(newData, format)
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		tAssertEQ(t, string(metadata), string(got), format)
+		m, err := DecodeNRGBA(newData)
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		tAssertEQ(t, image.Rect(0, 0, 400, 301), m.Rect, format)
+
+		// Set by libwebp, read by Go.
+		newData, err = webpSetMetadata(data, metadata, format)
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		got, err = riffGetMetadata(newData, format)
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		tAssertEQ(t, string(metadata), string(got), format)
+	}
+
+	_, err = riffGetMetadata(data, "EXIF")
+	tAssertNotNil(t, err)
+	_, err = riffSetMetadata(data, []byte("x"), "JPEG")
+	tAssertNotNil(t, err)
+}
+
+func TestPureGo_encodeLossless(t *testing.T) {
+	var images []*image.NRGBA
+	for _, filename := range []string{"1_webp_ll.png", "4_webp_ll.png", "video-001.png", "gopher-doc.1bpp.png"} {
+		m, err := loadImage(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		images = append(images, toNRGBAImage(m))
+	}
+	// A single color, a single pixel, and noise of a few colors in narrow
+	// images, for the distance codes of the neighbors.
+	uniform := image.NewNRGBA(image.Rect(0, 0, 33, 17))
+	for i := range uniform.Pix {
+		uniform.Pix[i] = 0x80
+	}
+	single := image.NewNRGBA(image.Rect(0, 0, 1, 1))
+	single.SetNRGBA(0, 0, color.NRGBA{1, 2, 3, 4})
+	images = append(images, uniform, single)
+	r := rand.New(rand.NewSource(1))
+	for _, width := range []int{1, 3, 7, 9, 40} {
+		noise := image.NewNRGBA(image.Rect(0, 0, width, 50))
+		for i := range noise.Pix {
+			noise.Pix[i] = byte(r.Intn(width%4+1) * 60)
+		}
+		images = append(images, noise)
+	}
+
+	for i, m := range images {
+		data, err := vp8lEncode(m, nil, nil)
+		if err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		want := &image.NRGBA{Pix: m.Pix, Stride: m.Stride, Rect: m.Rect.Sub(m.Rect.Min)}
+
+		got, err := DecodeNRGBA(data)
+		if err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		tAssertEQ(t, want.Rect, got.Rect, i)
+		tAssert(t, bytes.Equal(want.Pix, got.Pix), i)
+
+		goGot, err := goDecode(data)
+		if err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		tAssert(t, bytes.Equal(want.Pix, goGot.(*image.NRGBA).Pix), i)
+	}
+
+	_, err := vp8lEncode(image.NewNRGBA(image.Rect(0, 0, WebPMaxDimension+1, 1)), nil, nil)
+	tAssertNotNil(t, err)
+}
+
+func TestEncode_pureGo(t *testing.T) {
+	img0, err := loadImage("video-001.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var stats EncodeStats
+	buf := new(bytes.Buffer)
+	if err := Encode(buf, img0, &Options{Lossless: true, Exact: true, PureGo: true, Stats: &stats}); err != nil {
+		t.Fatal(err)
+	}
+	tAssertEQ(t, buf.Len(), stats.CodedSize)
+	tAssertEQ(t, LosslessPredictor|LosslessSubtractGreen, stats.LosslessFeatures)
+	tAssertEQ(t, stats.LosslessSize, stats.LosslessHdrSize+stats.LosslessDataSize)
+	img1, err := DecodeNRGBA(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := averageDeltaNRGBA(img0, img1); got != 0 {
+		t.Fatalf("average delta too high; got %d, want 0", got)
+	}
+
+	err = Encode(new(bytes.Buffer), img0, &Options{Quality: 90, PureGo: true})
+	tAssert(t, errors.Is(err, VP8EncErrorInvalidConfiguration), err)
+	var e *Error
+	tAssert(t, errors.As(err, &e) && e.EncodingError != VP8EncOk, err)
+}
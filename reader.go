@@ -2,11 +2,10 @@
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE file.
 
-// +build cgo
-
 package gowebp
 
 import (
+	"context"
 	"errors"
 	"image"
 	"image/color"
@@ -15,6 +14,113 @@ import (
 	"os"
 )
 
+// ErrImageTooLarge is returned when the dimensions of an image exceed the
+// limits of DecodeOptions.
+var ErrImageTooLarge = errors.New("webp: image is too large")
+
+// DecodeOptions are the decoding parameters.
+type DecodeOptions struct {
+	// The limits below are checked against the image header, before any
+	// pixel memory is allocated. Zero means no limit.
+	MaxWidth  int
+	MaxHeight int
+	MaxPixels int // Maximum width*height, of all the frames for DecodeAnimation.
+
+	// The fields below tune the decoder of libwebp, see WebPDecoderOptions.
+	BypassFiltering        bool // Skip the in-loop filtering of lossy images.
+	NoFancyUpsampling      bool // Upsample the chroma of lossy images without interpolation.
+	UseThreads             bool // Decode lossy images with a second thread.
+	DitheringStrength      int  // Dithering of lossy images, in [0..100], to hide banding.
+	AlphaDitheringStrength int  // Dithering of the alpha plane of lossy images, in [0..100].
+	Flip                   bool // Flip the output vertically.
+}
+
+// DefaultDecodeOptions are the options of Decode, and thus of image.Decode,
+// and of Load, which take none. Changing them is not safe while images are
+// being decoded; the other decode functions take their options per call.
+var DefaultDecodeOptions DecodeOptions
+
+// orDefault returns opt, or the zero DecodeOptions if opt is nil.
+func (opt *DecodeOptions) orDefault() *DecodeOptions {
+	if opt == nil {
+		return &DecodeOptions{}
+	}
+	return opt
+}
+
+// decoderOptions returns the tuning options of opt, or the defaults of
+// libwebp if opt is nil.
+func (opt *DecodeOptions) decoderOptions() *webpDecoderOptions {
+	opt = opt.orDefault()
+	return &webpDecoderOptions{
+		BypassFiltering:        opt.BypassFiltering,
+		NoFancyUpsampling:      opt.NoFancyUpsampling,
+		UseThreads:             opt.UseThreads,
+		DitheringStrength:      opt.DitheringStrength,
+		AlphaDitheringStrength: opt.AlphaDitheringStrength,
+		Flip:                   opt.Flip,
+	}
+}
+
+// webpDecoderOptions are the options of WebPDecoderOptions in use.
+type webpDecoderOptions struct {
+	Crop         image.Rectangle // Decode only this region, if not empty.
+	ScaledWidth  int             // Scale the (cropped) image, if not zero.
+	ScaledHeight int
+
+	BypassFiltering        bool
+	NoFancyUpsampling      bool
+	UseThreads             bool
+	DitheringStrength      int
+	AlphaDitheringStrength int
+	Flip                   bool
+}
+
+// outputSize returns the size of data decoded with opt, cropped then
+// scaled as libwebp does, or an error if data has no valid header.
+func (opt *webpDecoderOptions) outputSize(data []byte) (width, height int, err error) {
+	if width, height, _, err = webpGetInfo(data); err != nil || opt == nil {
+		return
+	}
+	if !opt.Crop.Empty() {
+		width, height = opt.Crop.Dx(), opt.Crop.Dy()
+	}
+	if opt.ScaledWidth != 0 || opt.ScaledHeight != 0 {
+		width, height = scaledSize(width, height, opt.ScaledWidth, opt.ScaledHeight)
+	}
+	return
+}
+
+// checkSize returns ErrImageTooLarge if width x height exceeds the limits.
+func (opt *DecodeOptions) checkSize(width, height int) error {
+	if opt == nil {
+		return nil
+	}
+	if opt.MaxWidth > 0 && width > opt.MaxWidth {
+		return ErrImageTooLarge
+	}
+	if opt.MaxHeight > 0 && height > opt.MaxHeight {
+		return ErrImageTooLarge
+	}
+	if opt.MaxPixels > 0 && width*height > opt.MaxPixels {
+		return ErrImageTooLarge
+	}
+	return nil
+}
+
+// checkAnimationSize is like checkSize for the canvas of an animation, and
+// also bounds the pixels of its frameCount frames, each the size of the
+// canvas, by MaxPixels.
+func (opt *DecodeOptions) checkAnimationSize(width, height, frameCount int) error {
+	if err := opt.checkSize(width, height); err != nil {
+		return err
+	}
+	if opt != nil && opt.MaxPixels > 0 && frameCount*width*height > opt.MaxPixels {
+		return ErrImageTooLarge
+	}
+	return nil
+}
+
 func LoadConfig(name string) (config image.Config, err error) {
 	f, err := os.Open(name)
 	if err != nil {
@@ -28,7 +134,7 @@ func LoadConfig(name string) (config image.Config, err error) {
 		return
 	}
 	header = header[:n]
-	width, height, _, err := GetInfo(header)
+	width, height, hasAlpha, err := GetInfo(header)
 	if err != nil {
 		return
 	}
@@ -36,6 +142,9 @@ func LoadConfig(name string) (config image.Config, err error) {
 	config.Width = width
 	config.Height = height
 	config.ColorModel = color.RGBAModel
+	if hasAlpha {
+		config.ColorModel = color.NRGBAModel
+	}
 	return
 }
 
@@ -58,10 +167,20 @@ func Load(name string) (m image.Image, err error) {
 	if _, err = f.Read(data); err != nil {
 		return nil, err
 	}
-	if m, err = DecodeRGBA(data); err != nil {
+	return decodeImage(data, &DefaultDecodeOptions)
+}
+
+// decodeImage decodes data to an *image.NRGBA if the image has an alpha
+// channel, or to an *image.RGBA otherwise.
+func decodeImage(data []byte, opt *DecodeOptions) (m image.Image, err error) {
+	_, _, hasAlpha, err := GetInfo(data)
+	if err != nil {
 		return
 	}
-	return
+	if hasAlpha {
+		return DecodeNRGBAWithOptions(data, opt)
+	}
+	return DecodeRGBAWithOptions(data, opt)
 }
 
 // DecodeConfig returns the color model and dimensions of a WEBP image without
@@ -73,26 +192,84 @@ func DecodeConfig(r io.Reader) (config image.Config, err error) {
 		return
 	}
 	header, err = header[:n], nil
-	width, height, _, err := GetInfo(header)
+	width, height, hasAlpha, err := GetInfo(header)
 	if err != nil {
 		return
 	}
 	config.Width = width
 	config.Height = height
 	config.ColorModel = color.RGBAModel
+	if hasAlpha {
+		config.ColorModel = color.NRGBAModel
+	}
 	return
 }
 
-// Decode reads a WEBP image from r and returns it as an image.Image.
+// Decode reads a WEBP image from r and returns it as an image.Image. Images
+// with an alpha channel are returned as an *image.NRGBA, others as an
+// *image.RGBA. It decodes with DefaultDecodeOptions.
 func Decode(r io.Reader) (m image.Image, err error) {
 	data, err := ioutil.ReadAll(r)
 	if err != nil {
 		return
 	}
-	if m, err = DecodeRGBA(data); err != nil {
+	return decodeImage(data, &DefaultDecodeOptions)
+}
+
+// DecodeContext reads a WEBP image from r and decodes it while the data
+// arrives, checking the limits of opt against the header first. A nil opt
+// means the zero DecodeOptions. Decoding stops and returns ctx.Err() as soon
+// as ctx is done.
+//
+// Unlike Decode, it always returns an *image.RGBA, with premultiplied alpha,
+// as IncrementalDecoder does.
+func DecodeContext(ctx context.Context, r io.Reader, opt *DecodeOptions) (m image.Image, err error) {
+	opt = opt.orDefault()
+	d, err := NewIncrementalDecoderWithOptions(opt)
+	if err != nil {
 		return
 	}
-	return
+	defer d.Close()
+
+	var buf = make([]byte, 32<<10)
+	var header []byte
+	var headerChecked bool
+	for !d.Done() {
+		if err = ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		n, readErr := r.Read(buf)
+		data := buf[:n]
+		if !headerChecked {
+			header = append(header, data...)
+			if len(header) < maxWebpHeaderSize && readErr == nil {
+				continue
+			}
+			if readErr != nil && readErr != io.EOF && readErr != io.ErrUnexpectedEOF {
+				return nil, readErr
+			}
+			var width, height int
+			if width, height, _, err = GetInfo(header); err != nil {
+				return nil, err
+			}
+			if err = opt.checkSize(width, height); err != nil {
+				return nil, err
+			}
+			data, headerChecked = header, true
+		}
+
+		if _, err = d.Write(data); err != nil {
+			return nil, err
+		}
+		if readErr == io.EOF && !d.Done() {
+			return nil, io.ErrUnexpectedEOF
+		}
+		if readErr != nil && readErr != io.EOF {
+			return nil, readErr
+		}
+	}
+	return d.Finish()
 }
 
 func init() {
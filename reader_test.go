@@ -5,10 +5,16 @@
 package gowebp
 
 import (
+	"bytes"
+	"context"
 	"image"
+	"image/color"
 	_ "image/png"
+	"io"
+	"io/ioutil"
 	"os"
 	"testing"
+	"testing/iotest"
 )
 
 const testdataDir = "./testdata/"
@@ -62,6 +68,24 @@ func averageDelta(m0, m1 image.Image) int {
 	return int((sum / n) >> 8)
 }
 
+// averageDeltaNRGBA is like averageDelta, in non-premultiplied RGBA space.
+func averageDeltaNRGBA(m0, m1 image.Image) int {
+	b := m0.Bounds()
+	var sum, n int64
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c0 := color.NRGBAModel.Convert(m0.At(x, y)).(color.NRGBA)
+			c1 := color.NRGBAModel.Convert(m1.At(x, y)).(color.NRGBA)
+			sum += delta(uint32(c0.R), uint32(c1.R))
+			sum += delta(uint32(c0.G), uint32(c1.G))
+			sum += delta(uint32(c0.B), uint32(c1.B))
+			sum += delta(uint32(c0.A), uint32(c1.A))
+			n += 4
+		}
+	}
+	return int(sum / n)
+}
+
 func delta(u0, u1 uint32) int64 {
 	d := int64(u0) - int64(u1)
 	if d < 0 {
@@ -69,3 +93,51 @@ func delta(u0, u1 uint32) int64 {
 	}
 	return d
 }
+
+func TestDecodeContext(t *testing.T) {
+	data, err := ioutil.ReadFile(testdataDir + "video-001.webp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := DecodeRGBA(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := want.Bounds()
+
+	m, err := DecodeContext(context.Background(), iotest.HalfReader(bytes.NewReader(data)), &DecodeOptions{
+		MaxWidth:  b.Dx(),
+		MaxHeight: b.Dy(),
+		MaxPixels: b.Dx() * b.Dy(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tAssertEQ(t, want.Pix, m.(*image.RGBA).Pix)
+
+	for i, opt := range []*DecodeOptions{
+		{MaxWidth: b.Dx() - 1},
+		{MaxHeight: b.Dy() - 1},
+		{MaxPixels: b.Dx()*b.Dy() - 1},
+	} {
+		if _, err := DecodeContext(context.Background(), bytes.NewReader(data), opt); err != ErrImageTooLarge {
+			t.Fatalf("%d: expect ErrImageTooLarge, got %v", i, err)
+		}
+	}
+
+	if _, err := DecodeContext(context.Background(), bytes.NewReader(data[:len(data)/2]), nil); err != io.ErrUnexpectedEOF {
+		t.Fatalf("expect io.ErrUnexpectedEOF, got %v", err)
+	}
+	for _, n := range []int{0, 16, 1000} {
+		r := io.MultiReader(bytes.NewReader(data[:n]), iotest.ErrReader(iotest.ErrTimeout))
+		if _, err := DecodeContext(context.Background(), r, nil); err != iotest.ErrTimeout {
+			t.Fatalf("%d: expect iotest.ErrTimeout, got %v", n, err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := DecodeContext(ctx, bytes.NewReader(data), nil); err != context.Canceled {
+		t.Fatalf("expect context.Canceled, got %v", err)
+	}
+}
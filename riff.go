@@ -0,0 +1,355 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gowebp
+
+import (
+	"encoding/binary"
+	"image/color"
+)
+
+// The RIFF container of WEBP, parsed in Go for the pure Go fallback.
+// See https://developers.google.com/speed/webp/docs/riff_container.
+
+// riffChunk is a chunk of a RIFF container. The data of the last chunk may be
+// truncated.
+type riffChunk struct {
+	id   string
+	data []byte
+}
+
+// riffFrame is an ANMF chunk of an animation.
+type riffFrame struct {
+	x, y, width, height int
+	duration            int
+	blend, dispose      bool
+	chunks              []riffChunk // ALPH and VP8, or VP8L.
+}
+
+// riffChunks splits data into its chunks. It reports whether data ends
+// before the end of the container.
+func riffChunks(data []byte) (chunks []riffChunk, truncated bool, err error) {
+	if len(data) < 12 {
+		if n := len(data); n > 4 || string(data) != "RIFF"[:n] {
+			return nil, false, newDecodeError("riffChunks", VP8StatusBitstreamError)
+		}
+		return nil, true, newDecodeError("riffChunks", VP8StatusNotEnoughData)
+	}
+	if string(data[0:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return nil, false, newDecodeError("riffChunks", VP8StatusBitstreamError)
+	}
+	size := int(binary.LittleEndian.Uint32(data[4:]))
+	if size < 4 {
+		return nil, false, newDecodeError("riffChunks", VP8StatusBitstreamError)
+	}
+	if end := 8 + size; end < len(data) {
+		data = data[:end]
+	} else if end > len(data) {
+		truncated = true
+	}
+	chunks, chunksTruncated := riffSplit(data[12:])
+	return chunks, truncated || chunksTruncated, nil
+}
+
+// riffSplit splits data into chunks, stopping at the first truncated one.
+func riffSplit(data []byte) (chunks []riffChunk, truncated bool) {
+	for len(data) > 0 {
+		if len(data) < 8 {
+			return chunks, true
+		}
+		id, size := string(data[0:4]), int(binary.LittleEndian.Uint32(data[4:]))
+		data = data[8:]
+		if size > len(data) {
+			return append(chunks, riffChunk{id, data}), true
+		}
+		chunks = append(chunks, riffChunk{id, data[:size:size]})
+		if size += size & 1; size > len(data) {
+			size = len(data)
+		}
+		data = data[size:]
+	}
+	return chunks, false
+}
+
+// riffFrames returns the ANMF chunks of chunks. A truncated frame is left
+// out.
+func riffFrames(chunks []riffChunk) (frames []riffFrame) {
+	for _, c := range chunks {
+		if c.id != "ANMF" || len(c.data) < 16 {
+			continue
+		}
+		sub, truncated := riffSplit(c.data[16:])
+		if truncated {
+			break
+		}
+		frames = append(frames, riffFrame{
+			x:        2 * le24(c.data[0:]),
+			y:        2 * le24(c.data[3:]),
+			width:    1 + le24(c.data[6:]),
+			height:   1 + le24(c.data[9:]),
+			duration: le24(c.data[12:]),
+			blend:    c.data[15]&0x02 == 0,
+			dispose:  c.data[15]&0x01 != 0,
+			chunks:   sub,
+		})
+	}
+	return
+}
+
+// riffBitstreamInfo returns the header of a VP8 or VP8L chunk.
+func riffBitstreamInfo(c riffChunk) (width, height int, hasAlpha bool, format Format, err error) {
+	switch c.id {
+	case "VP8 ":
+		if len(c.data) < 10 {
+			err = newDecodeError("riffBitstreamInfo", VP8StatusNotEnoughData)
+			return
+		}
+		if c.data[0]&1 != 0 || c.data[3] != 0x9d || c.data[4] != 0x01 || c.data[5] != 0x2a {
+			err = newDecodeError("riffBitstreamInfo", VP8StatusBitstreamError)
+			return
+		}
+		width = int(binary.LittleEndian.Uint16(c.data[6:]) & 0x3fff)
+		height = int(binary.LittleEndian.Uint16(c.data[8:]) & 0x3fff)
+		format = FormatLossy
+	case "VP8L":
+		if len(c.data) < 5 {
+			err = newDecodeError("riffBitstreamInfo", VP8StatusNotEnoughData)
+			return
+		}
+		bits := binary.LittleEndian.Uint32(c.data[1:])
+		if c.data[0] != vp8lSignature || bits>>29 != 0 {
+			err = newDecodeError("riffBitstreamInfo", VP8StatusBitstreamError)
+			return
+		}
+		width = 1 + int(bits&0x3fff)
+		height = 1 + int(bits>>14&0x3fff)
+		hasAlpha = bits>>28&1 != 0
+		format = FormatLossless
+	default:
+		err = newDecodeError("riffBitstreamInfo", VP8StatusBitstreamError)
+	}
+	return
+}
+
+// riffGetFeatures is the pure Go version of webpGetFeatures. Like the demuxer
+// of libwebp, it reports a loop count of 1 and a white background for a still
+// image.
+func riffGetFeatures(data []byte) (features Features, err error) {
+	chunks, truncated, err := riffChunks(data)
+	if err != nil {
+		return
+	}
+	if len(chunks) == 0 {
+		err = newDecodeError("riffGetFeatures", VP8StatusNotEnoughData)
+		return
+	}
+
+	var f Features
+	if c := chunks[0]; c.id != "VP8X" {
+		if f.Width, f.Height, f.HasAlpha, f.Format, err = riffBitstreamInfo(c); err != nil {
+			return
+		}
+		f.FrameWidth, f.FrameHeight, f.FrameCount = f.Width, f.Height, 1
+		f.LoopCount, f.BackgroundColor = 1, color.NRGBA{0xff, 0xff, 0xff, 0xff}
+		return f, nil
+	}
+
+	vp8x := chunks[0].data
+	if len(vp8x) < 10 {
+		err = newDecodeError("riffGetFeatures", VP8StatusNotEnoughData)
+		return
+	}
+	flags := vp8x[0]
+	f.Width, f.Height = 1+le24(vp8x[4:]), 1+le24(vp8x[7:])
+	f.HasAlpha = flags&vp8xFlagAlpha != 0
+	f.HasAnimation = flags&vp8xFlagAnimation != 0
+	f.HasICC = flags&vp8xFlagICC != 0
+	f.HasEXIF = flags&vp8xFlagEXIF != 0
+	f.HasXMP = flags&vp8xFlagXMP != 0
+
+	if f.HasAnimation {
+		for _, c := range chunks[1:] {
+			if c.id == "ANIM" && len(c.data) >= 6 {
+				bgcolor := binary.LittleEndian.Uint32(c.data)
+				f.BackgroundColor.R = uint8(bgcolor >> 16)
+				f.BackgroundColor.G = uint8(bgcolor >> 8)
+				f.BackgroundColor.B = uint8(bgcolor >> 0)
+				f.BackgroundColor.A = uint8(bgcolor >> 24)
+				f.LoopCount = int(binary.LittleEndian.Uint16(c.data[4:]))
+			}
+		}
+		for i, frame := range riffFrames(chunks) {
+			if i == 0 {
+				f.FrameWidth, f.FrameHeight = frame.width, frame.height
+			}
+			f.FrameCount++
+			for _, c := range frame.chunks {
+				if c.id == "VP8 " || c.id == "VP8L" {
+					f.Format = mergeFormat(f.Format, c.id)
+				}
+			}
+		}
+		return f, nil
+	}
+
+	for _, c := range chunks[1:] {
+		switch c.id {
+		case "ALPH":
+			f.HasAlpha = true
+		case "VP8 ", "VP8L":
+			_, _, hasAlpha, format, err := riffBitstreamInfo(c)
+			if err != nil {
+				return features, err
+			}
+			f.HasAlpha = f.HasAlpha || hasAlpha
+			f.Format = format
+			f.FrameWidth, f.FrameHeight, f.FrameCount = f.Width, f.Height, 1
+			f.LoopCount, f.BackgroundColor = 1, color.NRGBA{0xff, 0xff, 0xff, 0xff}
+			return f, nil
+		}
+	}
+	if !truncated {
+		err = newDecodeError("riffGetFeatures", VP8StatusBitstreamError)
+		return
+	}
+	return f, nil
+}
+
+// mergeFormat adds a frame coded in a chunk of that id to the format of an
+// animation.
+func mergeFormat(format Format, id string) Format {
+	frameFormat := FormatLossy
+	if id == "VP8L" {
+		frameFormat = FormatLossless
+	}
+	if format != FormatUnknown && format != frameFormat {
+		return FormatMixed
+	}
+	return frameFormat
+}
+
+// riffMetadataID returns the chunk ID of a metadata format.
+func riffMetadataID(format string) (id string, flag byte, ok bool) {
+	switch format {
+	case "EXIF":
+		return "EXIF", vp8xFlagEXIF, true
+	case "ICCP":
+		return "ICCP", vp8xFlagICC, true
+	case "XMP":
+		return "XMP ", vp8xFlagXMP, true
+	}
+	return "", 0, false
+}
+
+// riffGetMetadata is the pure Go version of webpGetMetadata.
+func riffGetMetadata(data []byte, format string) (metadata []byte, err error) {
+	id, _, ok := riffMetadataID(format)
+	if !ok {
+		return nil, newDecodeError("riffGetMetadata", VP8StatusInvalidParam)
+	}
+	chunks, _, err := riffChunks(data)
+	if err != nil {
+		return
+	}
+	for _, c := range chunks {
+		if c.id == id {
+			return append([]byte(nil), c.data...), nil
+		}
+	}
+	return nil, newDecodeError("riffGetMetadata", VP8StatusInvalidParam)
+}
+
+// riffSetMetadata is the pure Go version of webpSetMetadata. It adds a VP8X
+// chunk to a simple file.
+func riffSetMetadata(data, metadata []byte, format string) (newData []byte, err error) {
+	id, flag, ok := riffMetadataID(format)
+	if !ok || len(metadata) == 0 {
+		return nil, newDecodeError("riffSetMetadata", VP8StatusInvalidParam)
+	}
+	features, err := riffGetFeatures(data)
+	if err != nil {
+		return
+	}
+	chunks, truncated, err := riffChunks(data)
+	if err != nil {
+		return
+	}
+	if truncated {
+		return nil, newDecodeError("riffSetMetadata", VP8StatusNotEnoughData)
+	}
+
+	var flags byte
+	if features.HasAlpha {
+		flags |= vp8xFlagAlpha
+	}
+	var rest []riffChunk
+	for _, c := range chunks {
+		switch c.id {
+		case "VP8X":
+			flags = c.data[0]
+		case id:
+		default:
+			rest = append(rest, c)
+		}
+	}
+	flags |= flag
+
+	// The chunk order is VP8X, ICCP, the image, EXIF and XMP.
+	var vp8x = make([]byte, 10)
+	vp8x[0] = flags
+	putLE24(vp8x[4:], features.Width-1)
+	putLE24(vp8x[7:], features.Height-1)
+	var chunk = riffChunk{id, metadata}
+	var inserted = id == "ICCP"
+	chunks = []riffChunk{{"VP8X", vp8x}}
+	if inserted {
+		chunks = append(chunks, chunk)
+	}
+	for _, c := range rest {
+		if !inserted && id == "EXIF" && c.id == "XMP " {
+			chunks, inserted = append(chunks, chunk), true
+		}
+		chunks = append(chunks, c)
+	}
+	if !inserted {
+		chunks = append(chunks, chunk)
+	}
+	return riffAssemble(chunks), nil
+}
+
+// riffAssemble writes chunks to a new WEBP container.
+func riffAssemble(chunks []riffChunk) []byte {
+	size := 4
+	for _, c := range chunks {
+		size += 8 + len(c.data) + len(c.data)&1
+	}
+	data := make([]byte, 12, 8+size)
+	copy(data, "RIFF")
+	binary.LittleEndian.PutUint32(data[4:], uint32(size))
+	copy(data[8:], "WEBP")
+	for _, c := range chunks {
+		data = riffAppendChunk(data, c)
+	}
+	return data
+}
+
+// riffAppendChunk appends c to b, padded to an even size.
+func riffAppendChunk(b []byte, c riffChunk) []byte {
+	var header [8]byte
+	copy(header[:], c.id)
+	binary.LittleEndian.PutUint32(header[4:], uint32(len(c.data)))
+	b = append(append(b, header[:]...), c.data...)
+	if len(c.data)&1 != 0 {
+		b = append(b, 0)
+	}
+	return b
+}
+
+func le24(b []byte) int {
+	return int(b[0]) | int(b[1])<<8 | int(b[2])<<16
+}
+
+func putLE24(b []byte, v int) {
+	b[0], b[1], b[2] = byte(v), byte(v>>8), byte(v>>16)
+}
@@ -0,0 +1,767 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gowebp
+
+import (
+	"image"
+	"math"
+	"math/bits"
+	"sort"
+)
+
+// The pure Go VP8L encoder, see
+// https://developers.google.com/speed/webp/docs/webp_lossless_bitstream_specification.
+//
+// The pixels go through the subtract-green and predictor transforms, then
+// are coded with LZ77 backward references, a color cache and a single group
+// of prefix codes. The output is not as small as the one of libwebp, but it
+// is fast and exact.
+
+const (
+	vp8lSignature     = 0x2f
+	vp8lMaxCodeLength = 15
+
+	vp8lNumLiteralCodes  = 256
+	vp8lNumLengthCodes   = 24
+	vp8lNumDistanceCodes = 40
+	vp8lNumCodeLengths   = 19 // Symbols of the code length code.
+	vp8lNumPredictors    = 14
+
+	vp8lPredictorTransform     = 0
+	vp8lSubtractGreenTransform = 2
+
+	vp8lPredictorBits = 4  // Tiles of 16x16 pixels share a predictor.
+	vp8lMaxCacheBits  = 10 // The bitstream allows 11.
+
+	vp8lColorCacheMultiplier = 0x1e35a7bd
+
+	vp8lMaxLength   = 4096
+	vp8lMaxDistance = 1<<20 - 120
+	vp8lMinLength   = 3  // Shorter matches are coded as literals.
+	vp8lHashBits    = 18 // Bits of the hash of two pixels.
+	vp8lMaxChain    = 32 // Candidates tried for each match.
+)
+
+// vp8lCodeLengthOrder is the order of the code lengths of the code length
+// code in the bitstream.
+var vp8lCodeLengthOrder = [vp8lNumCodeLengths]int{
+	17, 18, 0, 1, 2, 3, 4, 5, 16, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15,
+}
+
+// vp8lDistanceMap is the table of the 120 distance codes of the nearest
+// pixels, as yOffset<<4 | (8-xOffset).
+var vp8lDistanceMap = [120]uint8{
+	0x18, 0x07, 0x17, 0x19, 0x28, 0x06, 0x27, 0x29, 0x16, 0x1a,
+	0x26, 0x2a, 0x38, 0x05, 0x37, 0x39, 0x15, 0x1b, 0x36, 0x3a,
+	0x25, 0x2b, 0x48, 0x04, 0x47, 0x49, 0x14, 0x1c, 0x35, 0x3b,
+	0x46, 0x4a, 0x24, 0x2c, 0x58, 0x45, 0x4b, 0x34, 0x3c, 0x03,
+	0x57, 0x59, 0x13, 0x1d, 0x56, 0x5a, 0x23, 0x2d, 0x44, 0x4c,
+	0x55, 0x5b, 0x33, 0x3d, 0x68, 0x02, 0x67, 0x69, 0x12, 0x1e,
+	0x66, 0x6a, 0x22, 0x2e, 0x54, 0x5c, 0x43, 0x4d, 0x65, 0x6b,
+	0x32, 0x3e, 0x78, 0x01, 0x77, 0x79, 0x53, 0x5d, 0x11, 0x1f,
+	0x64, 0x6c, 0x42, 0x4e, 0x76, 0x7a, 0x21, 0x2f, 0x75, 0x7b,
+	0x31, 0x3f, 0x63, 0x6d, 0x52, 0x5e, 0x00, 0x74, 0x7c, 0x41,
+	0x4f, 0x10, 0x20, 0x62, 0x6e, 0x30, 0x73, 0x7d, 0x51, 0x5f,
+	0x40, 0x72, 0x7e, 0x61, 0x6f, 0x50, 0x71, 0x7f, 0x60, 0x70,
+}
+
+// vp8lEncode encodes m to a lossless WEBP file. The RGB values of
+// transparent pixels are kept. The statistics are stored in stats and the
+// progress is reported to progress, if they are not nil.
+func vp8lEncode(m *image.NRGBA, stats *EncodeStats, progress *encodeProgress) (data []byte, err error) {
+	width, height := m.Rect.Dx(), m.Rect.Dy()
+	if width <= 0 || height <= 0 || width > WebPMaxDimension || height > WebPMaxDimension {
+		return nil, newEncodeError("vp8lEncode", VP8EncErrorBadDimension)
+	}
+	report := func(percent int) bool {
+		return progress == nil || progress.report(percent)
+	}
+	if !report(0) {
+		return nil, newEncodeError("vp8lEncode", VP8EncErrorUserAbort)
+	}
+
+	// The pixels are kept in the RGBA order of m, and packed as ARGB for
+	// the entropy coding.
+	var hasAlpha bool
+	pix := make([]byte, 4*width*height)
+	for y := 0; y < height; y++ {
+		copy(pix[4*width*y:], m.Pix[m.PixOffset(m.Rect.Min.X, m.Rect.Min.Y+y):][:4*width])
+	}
+	for i := 0; i < len(pix); i += 4 {
+		hasAlpha = hasAlpha || pix[i+3] != 0xff
+		pix[i+0] -= pix[i+1]
+		pix[i+2] -= pix[i+1]
+	}
+	residuals, modes, ok := vp8lPredict(pix, width, height, vp8lPredictorBits, func(percent int) bool {
+		return report(1 + percent/2)
+	})
+	if !ok {
+		return nil, newEncodeError("vp8lEncode", VP8EncErrorUserAbort)
+	}
+	argb := vp8lARGB(residuals)
+	refs, ok := vp8lBackwardRefs(argb, width, func(y int) bool {
+		return report(51 + 48*y/height)
+	})
+	if !ok {
+		return nil, newEncodeError("vp8lEncode", VP8EncErrorUserAbort)
+	}
+	cacheBits := vp8lCacheBits(argb, refs)
+
+	var w vp8lBitWriter
+	w.writeBits(vp8lSignature, 8)
+	w.writeBits(uint32(width-1), 14)
+	w.writeBits(uint32(height-1), 14)
+	if hasAlpha {
+		w.writeBits(1, 1)
+	} else {
+		w.writeBits(0, 1)
+	}
+	w.writeBits(0, 3) // Version.
+
+	// The decoder undoes the transforms in the reverse order.
+	w.writeBits(1, 1)
+	w.writeBits(vp8lSubtractGreenTransform, 2)
+	w.writeBits(1, 1)
+	w.writeBits(vp8lPredictorTransform, 2)
+	w.writeBits(vp8lPredictorBits-2, 3)
+	modesARGB := vp8lARGB(modes)
+	modeRefs, _ := vp8lBackwardRefs(modesARGB, vp8lSubSampleSize(width, vp8lPredictorBits), nil)
+	w.writeImage(modesARGB, modeRefs, 0, false)
+	w.writeBits(0, 1) // No more transforms.
+
+	start := w.writeImage(argb, refs, cacheBits, true)
+	if !report(100) {
+		return nil, newEncodeError("vp8lEncode", VP8EncErrorUserAbort)
+	}
+
+	bitstream := w.bytes()
+	data = riffAssemble([]riffChunk{{"VP8L", bitstream}})
+	if stats != nil {
+		*stats = EncodeStats{
+			CodedSize:        len(data),
+			LosslessFeatures: LosslessPredictor | LosslessSubtractGreen,
+			TransformBits:    vp8lPredictorBits,
+			CacheBits:        cacheBits,
+			LosslessSize:     len(bitstream),
+			LosslessHdrSize:  start / 8,
+			LosslessDataSize: len(bitstream) - start/8,
+		}
+	}
+	return data, nil
+}
+
+// vp8lSubSampleSize returns the number of tiles of 1<<bits pixels in size.
+func vp8lSubSampleSize(size, bits int) int {
+	return (size + 1<<bits - 1) >> bits
+}
+
+// vp8lARGB packs the RGBA pixels of pix as ARGB.
+func vp8lARGB(pix []byte) []uint32 {
+	argb := make([]uint32, len(pix)/4)
+	for i := range argb {
+		p := pix[4*i : 4*i+4]
+		argb[i] = uint32(p[3])<<24 | uint32(p[0])<<16 | uint32(p[1])<<8 | uint32(p[2])
+	}
+	return argb
+}
+
+// vp8lPredict applies the predictor transform to the RGBA pixels of pix. It
+// returns the residuals and the image of the predictor modes of the tiles
+// of 1<<bits pixels, the mode being stored in green. The mode of a tile is
+// the one with the lowest entropy of residuals. The progress is reported
+// to report, which returns false to abort.
+func vp8lPredict(pix []byte, width, height, bits int, report func(percent int) bool) (residuals, modes []byte, ok bool) {
+	tileWidth, tileHeight := vp8lSubSampleSize(width, bits), vp8lSubSampleSize(height, bits)
+	modes = make([]byte, 4*tileWidth*tileHeight)
+
+	var counts [4][256]int
+	tile := make([]byte, 0, 4<<(2*bits))
+	nlogn := make([]float64, 1<<(2*bits)+1)
+	for n := 1; n < len(nlogn); n++ {
+		nlogn[n] = float64(n) * math.Log2(float64(n))
+	}
+	for ty := 0; ty < tileHeight; ty++ {
+		if report != nil && !report(100*ty/tileHeight) {
+			return nil, nil, false
+		}
+		y0, y1 := maxInt(ty<<bits, 1), minInt((ty+1)<<bits, height)
+		for tx := 0; tx < tileWidth; tx++ {
+			x0, x1 := maxInt(tx<<bits, 1), minInt((tx+1)<<bits, width)
+
+			// The cost is the entropy of the residuals, plus a small bias
+			// towards small residuals, which are shared by the tiles.
+			best, bestCost := 0, math.Inf(1)
+			for mode := 0; mode < vp8lNumPredictors; mode++ {
+				tile = tile[:0]
+				var magnitude int
+				for y := y0; y < y1; y++ {
+					for x := x0; x < x1; x++ {
+						p := 4 * (y*width + x)
+						pred := vp8lPredictor(pix, p, p-4*width, mode)
+						for c := 0; c < 4; c++ {
+							v := pix[p+c] - pred[c]
+							counts[c][v]++
+							tile = append(tile, v)
+							magnitude += absInt(int(int8(v)))
+						}
+					}
+				}
+				cost := float64(magnitude) / 16
+				for i, v := range tile {
+					c := i % 4
+					if n := counts[c][v]; n > 0 {
+						cost -= nlogn[n]
+						counts[c][v] = 0
+					}
+				}
+				if cost < bestCost {
+					best, bestCost = mode, cost
+				}
+			}
+			modes[4*(ty*tileWidth+tx)+1] = byte(best)
+		}
+	}
+
+	// The first pixel is predicted by opaque black, the rest of the first
+	// row by L and the first column by T.
+	residuals = make([]byte, len(pix))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			p := 4 * (y*width + x)
+			var pred [4]byte
+			switch {
+			case x == 0 && y == 0:
+				pred[3] = 0xff
+			case y == 0:
+				copy(pred[:], pix[p-4:])
+			case x == 0:
+				copy(pred[:], pix[p-4*width:])
+			default:
+				mode := modes[4*((y>>bits)*tileWidth+x>>bits)+1]
+				pred = vp8lPredictor(pix, p, p-4*width, int(mode))
+			}
+			for c := 0; c < 4; c++ {
+				residuals[p+c] = pix[p+c] - pred[c]
+			}
+		}
+	}
+	return residuals, modes, true
+}
+
+// vp8lPredictor returns the prediction by mode of the pixel at p, top being
+// the pixel above it. The pixel is neither in the first row nor in the
+// first column. The top-right pixel of the last column is the first pixel
+// of the row, as it comes next in memory.
+func vp8lPredictor(pix []byte, p, top, mode int) (pred [4]byte) {
+	if mode == 11 { // Select(L, T, TL).
+		var pl, pt int
+		for c := 0; c < 4; c++ {
+			pl += absInt(int(pix[top+c]) - int(pix[top-4+c]))
+			pt += absInt(int(pix[p-4+c]) - int(pix[top-4+c]))
+		}
+		if pl < pt {
+			copy(pred[:], pix[p-4:])
+		} else {
+			copy(pred[:], pix[top:])
+		}
+		return
+	}
+	for c := 0; c < 4; c++ {
+		l, t, tr, tl := pix[p-4+c], pix[top+c], pix[top+4+c], pix[top-4+c]
+		switch mode {
+		case 0: // Opaque black.
+			if c == 3 {
+				pred[c] = 0xff
+			}
+		case 1:
+			pred[c] = l
+		case 2:
+			pred[c] = t
+		case 3:
+			pred[c] = tr
+		case 4:
+			pred[c] = tl
+		case 5:
+			pred[c] = vp8lAverage2(vp8lAverage2(l, tr), t)
+		case 6:
+			pred[c] = vp8lAverage2(l, tl)
+		case 7:
+			pred[c] = vp8lAverage2(l, t)
+		case 8:
+			pred[c] = vp8lAverage2(tl, t)
+		case 9:
+			pred[c] = vp8lAverage2(t, tr)
+		case 10:
+			pred[c] = vp8lAverage2(vp8lAverage2(l, tl), vp8lAverage2(t, tr))
+		case 12: // ClampAddSubtractFull(L, T, TL).
+			pred[c] = clampUint8(int(l) + int(t) - int(tl))
+		case 13: // ClampAddSubtractHalf(Average2(L, T), TL).
+			a := int(vp8lAverage2(l, t))
+			pred[c] = clampUint8(a + (a-int(tl))/2)
+		}
+	}
+	return
+}
+
+func vp8lAverage2(a, b uint8) uint8 {
+	return uint8((int(a) + int(b)) / 2)
+}
+
+// vp8lRef is a literal pixel, possibly found in the color cache, or a
+// backward reference.
+type vp8lRef struct {
+	length int32 // Length of the backward reference, 0 for a pixel.
+	dist   int32 // Distance code of the backward reference.
+}
+
+// vp8lBackwardRefs finds the backward references of argb greedily, in
+// chains of hashes of two pixels. The progress is reported with the current
+// row to report, if it is not nil, which returns false to abort.
+func vp8lBackwardRefs(argb []uint32, width int, report func(y int) bool) (refs []vp8lRef, ok bool) {
+	n := len(argb)
+	planeCodes := vp8lPlaneCodes(width)
+	head := make([]int32, 1<<vp8lHashBits)
+	for i := range head {
+		head[i] = -1
+	}
+	prev := make([]int32, n)
+	hash := func(i int) uint32 {
+		return (argb[i]*vp8lColorCacheMultiplier + argb[i+1]) * 0x9e3779b1 >> (32 - vp8lHashBits)
+	}
+	insert := func(i int) {
+		if i+1 < n {
+			h := hash(i)
+			prev[i], head[h] = head[h], int32(i)
+		}
+	}
+
+	refs = make([]vp8lRef, 0, n)
+	nextReport := 16 * width
+	for i := 0; i < n; {
+		if report != nil && i >= nextReport {
+			if !report(i / width) {
+				return nil, false
+			}
+			nextReport = (i/width + 16) * width
+		}
+
+		var length, dist int
+		if i+1 < n {
+			maxLength := minInt(vp8lMaxLength, n-i)
+			for j, chain := int(head[hash(i)]), 0; j >= 0 && chain < vp8lMaxChain && i-j <= vp8lMaxDistance; j, chain = int(prev[j]), chain+1 {
+				k := 0
+				for k < maxLength && argb[j+k] == argb[i+k] {
+					k++
+				}
+				if k > length {
+					length, dist = k, i-j
+					if k == maxLength {
+						break
+					}
+				}
+			}
+		}
+		if length < vp8lMinLength {
+			refs = append(refs, vp8lRef{})
+			insert(i)
+			i++
+			continue
+		}
+
+		code, ok := planeCodes[dist]
+		if !ok {
+			code = dist + len(vp8lDistanceMap)
+		}
+		refs = append(refs, vp8lRef{length: int32(length), dist: int32(code)})
+		for end := i + length; i < end; i++ {
+			insert(i)
+		}
+	}
+	return refs, true
+}
+
+// vp8lPlaneCodes returns the smallest distance codes of the distances of
+// vp8lDistanceMap, in an image of the given width.
+func vp8lPlaneCodes(width int) map[int]int {
+	codes := make(map[int]int, len(vp8lDistanceMap))
+	for i := len(vp8lDistanceMap) - 1; i >= 0; i-- {
+		v := int(vp8lDistanceMap[i])
+		codes[maxInt((v>>4)*width+8-v&0xf, 1)] = i + 1
+	}
+	return codes
+}
+
+// vp8lCacheBits returns the size of the color cache, in bits, which gives
+// the lowest entropy of the symbols of refs. 0 disables the color cache.
+func vp8lCacheBits(argb []uint32, refs []vp8lRef) int {
+	best, bestCost := 0, math.Inf(1)
+	for cacheBits := 0; cacheBits <= vp8lMaxCacheBits; cacheBits++ {
+		var cost float64
+		for _, h := range vp8lHistograms(argb, refs, cacheBits) {
+			var total float64
+			for _, n := range h {
+				if n > 0 {
+					cost -= float64(n) * math.Log2(float64(n))
+					total += float64(n)
+				}
+			}
+			if total > 0 {
+				cost += total * math.Log2(total)
+			}
+		}
+		if cost < bestCost {
+			best, bestCost = cacheBits, cost
+		}
+	}
+	return best
+}
+
+// vp8lHistograms returns the histograms of the symbols of the five prefix
+// codes of refs.
+func vp8lHistograms(argb []uint32, refs []vp8lRef, cacheBits int) [5][]int {
+	var histograms = [5][]int{
+		make([]int, vp8lNumLiteralCodes+vp8lNumLengthCodes),
+		make([]int, vp8lNumLiteralCodes),
+		make([]int, vp8lNumLiteralCodes),
+		make([]int, vp8lNumLiteralCodes),
+		make([]int, vp8lNumDistanceCodes),
+	}
+	if cacheBits > 0 {
+		histograms[0] = make([]int, vp8lNumLiteralCodes+vp8lNumLengthCodes+1<<cacheBits)
+	}
+	vp8lSymbols(argb, refs, cacheBits, func(code, symbol int, extra uint32, nbits uint) {
+		histograms[code][symbol]++
+	})
+	return histograms
+}
+
+// vp8lSymbols calls f with the symbols of refs and their extra bits, in the
+// order of the bitstream. The codes are 0 for green, lengths and the color
+// cache, 1 for red, 2 for blue, 3 for alpha and 4 for distances.
+func vp8lSymbols(argb []uint32, refs []vp8lRef, cacheBits int, f func(code, symbol int, extra uint32, nbits uint)) {
+	var cache []uint32
+	if cacheBits > 0 {
+		cache = make([]uint32, 1<<cacheBits)
+	}
+	shift := 32 - uint(cacheBits)
+
+	i := 0
+	for _, r := range refs {
+		if r.length == 0 {
+			p := argb[i]
+			i++
+			if cache != nil {
+				key := p * vp8lColorCacheMultiplier >> shift
+				if cache[key] == p {
+					f(0, vp8lNumLiteralCodes+vp8lNumLengthCodes+int(key), 0, 0)
+					continue
+				}
+				cache[key] = p
+			}
+			f(0, int(p>>8&0xff), 0, 0)
+			f(1, int(p>>16&0xff), 0, 0)
+			f(2, int(p&0xff), 0, 0)
+			f(3, int(p>>24), 0, 0)
+			continue
+		}
+
+		symbol, extra, nbits := vp8lPrefixCode(int(r.length))
+		f(0, vp8lNumLiteralCodes+symbol, extra, nbits)
+		symbol, extra, nbits = vp8lPrefixCode(int(r.dist))
+		f(4, symbol, extra, nbits)
+		if cache != nil {
+			for _, p := range argb[i : i+int(r.length)] {
+				cache[p*vp8lColorCacheMultiplier>>shift] = p
+			}
+		}
+		i += int(r.length)
+	}
+}
+
+// vp8lPrefixCode returns the prefix coding of a length or distance code v,
+// v >= 1: its symbol, followed by nbits extra bits.
+func vp8lPrefixCode(v int) (symbol int, extra uint32, nbits uint) {
+	v--
+	if v < 4 {
+		return v, 0, 0
+	}
+	high := bits.Len(uint(v)) - 1
+	nbits = uint(high - 1)
+	return 2*high + v>>nbits&1, uint32(v) & (1<<nbits - 1), nbits
+}
+
+// vp8lBitWriter writes the bits of a VP8L bitstream, least significant
+// first.
+type vp8lBitWriter struct {
+	buf   []byte
+	bits  uint64
+	nbits uint
+}
+
+func (w *vp8lBitWriter) writeBits(v uint32, n uint) {
+	w.bits |= uint64(v) << w.nbits
+	w.nbits += n
+	for w.nbits >= 8 {
+		w.buf = append(w.buf, byte(w.bits))
+		w.bits >>= 8
+		w.nbits -= 8
+	}
+}
+
+// len returns the number of bits written.
+func (w *vp8lBitWriter) len() int {
+	return 8*len(w.buf) + int(w.nbits)
+}
+
+func (w *vp8lBitWriter) bytes() []byte {
+	if w.nbits > 0 {
+		w.buf = append(w.buf, byte(w.bits))
+		w.bits, w.nbits = 0, 0
+	}
+	return w.buf
+}
+
+// writeImage writes the entropy coded image of refs, with a single group of
+// prefix codes if it is the main image. It returns the position, in bits,
+// of the coded pixels.
+func (w *vp8lBitWriter) writeImage(argb []uint32, refs []vp8lRef, cacheBits int, main bool) int {
+	if cacheBits > 0 {
+		w.writeBits(1, 1)
+		w.writeBits(uint32(cacheBits), 4)
+	} else {
+		w.writeBits(0, 1)
+	}
+	if main {
+		w.writeBits(0, 1) // A single prefix code group.
+	}
+
+	var codes [5]vp8lHuffmanCode
+	for i, h := range vp8lHistograms(argb, refs, cacheBits) {
+		codes[i] = w.writeHuffmanCode(h)
+	}
+	start := w.len()
+	vp8lSymbols(argb, refs, cacheBits, func(code, symbol int, extra uint32, nbits uint) {
+		codes[code].write(w, symbol)
+		if nbits > 0 {
+			w.writeBits(extra, nbits)
+		}
+	})
+	return start
+}
+
+// vp8lHuffmanCode is a canonical prefix code. The codes are bit-reversed, to
+// be written least significant bit first.
+type vp8lHuffmanCode struct {
+	lengths []uint8
+	codes   []uint16
+}
+
+func (c *vp8lHuffmanCode) write(w *vp8lBitWriter, symbol int) {
+	w.writeBits(uint32(c.codes[symbol]), uint(c.lengths[symbol]))
+}
+
+// newVP8LHuffmanCode returns the canonical code of lengths.
+func newVP8LHuffmanCode(lengths []uint8) vp8lHuffmanCode {
+	var count [vp8lMaxCodeLength + 1]int
+	for _, n := range lengths {
+		count[n]++
+	}
+	count[0] = 0
+	var next [vp8lMaxCodeLength + 1]int
+	for n, code := 1, 0; n <= vp8lMaxCodeLength; n++ {
+		code = (code + count[n-1]) << 1
+		next[n] = code
+	}
+
+	c := vp8lHuffmanCode{lengths: lengths, codes: make([]uint16, len(lengths))}
+	for symbol, n := range lengths {
+		if n == 0 {
+			continue
+		}
+		code := next[n]
+		next[n]++
+		var reversed uint16
+		for i := uint8(0); i < n; i++ {
+			reversed = reversed<<1 | uint16(code>>i&1)
+		}
+		c.codes[symbol] = reversed
+	}
+	return c
+}
+
+// writeHuffmanCode writes the prefix code of a histogram and returns it.
+func (w *vp8lBitWriter) writeHuffmanCode(histogram []int) vp8lHuffmanCode {
+	var symbols []int
+	for s, n := range histogram {
+		if n > 0 {
+			symbols = append(symbols, s)
+		}
+	}
+
+	// A simple code of one or two 8 bit symbols. A single symbol takes no
+	// bits at all.
+	if len(symbols) <= 2 && (len(symbols) == 0 || symbols[len(symbols)-1] < 256) {
+		lengths := make([]uint8, len(histogram))
+		if len(symbols) == 0 {
+			symbols = []int{0}
+		}
+		w.writeBits(1, 1)
+		w.writeBits(uint32(len(symbols)-1), 1)
+		w.writeBits(1, 1) // 8 bit symbols.
+		w.writeBits(uint32(symbols[0]), 8)
+		if len(symbols) == 2 {
+			w.writeBits(uint32(symbols[1]), 8)
+			lengths[symbols[0]], lengths[symbols[1]] = 1, 1
+		}
+		return newVP8LHuffmanCode(lengths)
+	}
+
+	lengths := huffmanCodeLengths(histogram, vp8lMaxCodeLength)
+	w.writeBits(0, 1)
+	w.writeCodeLengths(lengths)
+	return newVP8LHuffmanCode(lengths)
+}
+
+// writeCodeLengths writes lengths with the code length code, using the
+// repeat codes 16, 17 and 18 for runs.
+func (w *vp8lBitWriter) writeCodeLengths(lengths []uint8) {
+	type token struct {
+		symbol, extra int
+	}
+	var tokens []token
+	for i := 0; i < len(lengths); {
+		v := lengths[i]
+		run := 1
+		for i+run < len(lengths) && lengths[i+run] == v {
+			run++
+		}
+		i += run
+		if v != 0 {
+			tokens = append(tokens, token{int(v), 0})
+			run--
+			for ; run >= 3; run -= minInt(run, 6) {
+				tokens = append(tokens, token{16, minInt(run, 6) - 3})
+			}
+		} else {
+			for ; run >= 11; run -= minInt(run, 138) {
+				tokens = append(tokens, token{18, minInt(run, 138) - 11})
+			}
+			if run >= 3 {
+				tokens = append(tokens, token{17, run - 3})
+				run = 0
+			}
+		}
+		for ; run > 0; run-- {
+			tokens = append(tokens, token{int(v), 0})
+		}
+	}
+
+	var histogram = make([]int, vp8lNumCodeLengths)
+	for _, t := range tokens {
+		histogram[t.symbol]++
+	}
+	codeLengths := huffmanCodeLengths(histogram, 7)
+	n := vp8lNumCodeLengths
+	for n > 4 && codeLengths[vp8lCodeLengthOrder[n-1]] == 0 {
+		n--
+	}
+	w.writeBits(uint32(n-4), 4)
+	for _, s := range vp8lCodeLengthOrder[:n] {
+		w.writeBits(uint32(codeLengths[s]), 3)
+	}
+	w.writeBits(0, 1) // All the symbols are coded.
+
+	code := newVP8LHuffmanCode(codeLengths)
+	for _, t := range tokens {
+		code.write(w, t.symbol)
+		switch t.symbol {
+		case 16:
+			w.writeBits(uint32(t.extra), 2)
+		case 17:
+			w.writeBits(uint32(t.extra), 3)
+		case 18:
+			w.writeBits(uint32(t.extra), 7)
+		}
+	}
+}
+
+// huffmanCodeLengths returns the lengths of a Huffman code of histogram,
+// limited to maxLength. At least two symbols get a code, so that the code
+// is complete.
+func huffmanCodeLengths(histogram []int, maxLength int) []uint8 {
+	type node struct {
+		weight      int
+		symbol      int // -1 for an internal node.
+		left, right int
+	}
+
+	for minWeight := 1; ; minWeight *= 2 {
+		var leaves []node
+		for s, n := range histogram {
+			if n > 0 {
+				leaves = append(leaves, node{maxInt(n, minWeight), s, -1, -1})
+			}
+		}
+		for s := 0; len(leaves) < 2; s++ {
+			if histogram[s] == 0 {
+				leaves = append(leaves, node{minWeight, s, -1, -1})
+			}
+		}
+		sort.SliceStable(leaves, func(i, j int) bool { return leaves[i].weight < leaves[j].weight })
+
+		// Merge the two lightest nodes, taken from the sorted leaves or from
+		// the internal nodes, which are created in increasing weight.
+		nodes := leaves
+		var nextLeaf, nextInternal = 0, len(leaves)
+		lightest := func() int {
+			if nextLeaf < len(leaves) && (nextInternal >= len(nodes) || leaves[nextLeaf].weight <= nodes[nextInternal].weight) {
+				nextLeaf++
+				return nextLeaf - 1
+			}
+			nextInternal++
+			return nextInternal - 1
+		}
+		for i := 1; i < len(leaves); i++ {
+			a, b := lightest(), lightest()
+			nodes = append(nodes, node{nodes[a].weight + nodes[b].weight, -1, a, b})
+		}
+
+		lengths := make([]uint8, len(histogram))
+		depths := make([]int, len(nodes))
+		var tooLong bool
+		for i := len(nodes) - 1; i >= 0; i-- {
+			if n := nodes[i]; n.symbol >= 0 {
+				lengths[n.symbol] = uint8(depths[i])
+				tooLong = tooLong || depths[i] > maxLength
+			} else {
+				depths[n.left], depths[n.right] = depths[i]+1, depths[i]+1
+			}
+		}
+		if !tooLong {
+			return lengths
+		}
+	}
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func absInt(a int) int {
+	if a < 0 {
+		return -a
+	}
+	return a
+}
@@ -6,6 +6,7 @@ package gowebp
 
 import (
 	"image"
+	"reflect"
 	"strings"
 )
 
@@ -17,8 +18,21 @@ func GetInfo(data []byte) (width, height int, hasAlpha bool, err error) {
 	return webpGetInfo(data)
 }
 
+// GetFeatures inspects the headers and chunks of data without decoding the
+// image data. If data is truncated, only the frames found so far are
+// reported.
+func GetFeatures(data []byte) (features Features, err error) {
+	return webpGetFeatures(data)
+}
+
 func DecodeGray(data []byte) (m *image.Gray, err error) {
-	pix, w, h, err := webpDecodeGray(data)
+	return DecodeGrayWithOptions(data, nil)
+}
+
+// DecodeGrayWithOptions is like DecodeGray, but decodes with opt. A nil opt
+// means the zero DecodeOptions.
+func DecodeGrayWithOptions(data []byte, opt *DecodeOptions) (m *image.Gray, err error) {
+	pix, w, h, err := webpDecodeGray(data, opt)
 	if err != nil {
 		return
 	}
@@ -31,7 +45,13 @@ func DecodeGray(data []byte) (m *image.Gray, err error) {
 }
 
 func DecodeRGB(data []byte) (m *RGBImage, err error) {
-	pix, w, h, err := webpDecodeRGB(data)
+	return DecodeRGBWithOptions(data, nil)
+}
+
+// DecodeRGBWithOptions is like DecodeRGB, but decodes with opt, see
+// DecodeGrayWithOptions.
+func DecodeRGBWithOptions(data []byte, opt *DecodeOptions) (m *RGBImage, err error) {
+	pix, w, h, err := webpDecodeRGB(data, opt)
 	if err != nil {
 		return
 	}
@@ -43,8 +63,16 @@ func DecodeRGB(data []byte) (m *RGBImage, err error) {
 	return
 }
 
+// DecodeRGBA decodes data with premultiplied alpha, as image.RGBA holds it.
+// Use DecodeNRGBA to keep the alpha of the image separate.
 func DecodeRGBA(data []byte) (m *image.RGBA, err error) {
-	pix, w, h, err := webpDecodeRGBA(data)
+	return DecodeRGBAWithOptions(data, nil)
+}
+
+// DecodeRGBAWithOptions is like DecodeRGBA, but decodes with opt, see
+// DecodeGrayWithOptions.
+func DecodeRGBAWithOptions(data []byte, opt *DecodeOptions) (m *image.RGBA, err error) {
+	pix, w, h, err := webpDecodeRGBA(data, opt)
 	if err != nil {
 		return
 	}
@@ -56,11 +84,314 @@ func DecodeRGBA(data []byte) (m *image.RGBA, err error) {
 	return
 }
 
+// DecodeNRGBA decodes data with non-premultiplied alpha.
+func DecodeNRGBA(data []byte) (m *image.NRGBA, err error) {
+	return DecodeNRGBAWithOptions(data, nil)
+}
+
+// DecodeNRGBAWithOptions is like DecodeNRGBA, but decodes with opt, see
+// DecodeGrayWithOptions.
+func DecodeNRGBAWithOptions(data []byte, opt *DecodeOptions) (m *image.NRGBA, err error) {
+	pix, w, h, err := webpDecodeNRGBA(data, opt)
+	if err != nil {
+		return
+	}
+	m = &image.NRGBA{
+		Pix:    pix,
+		Stride: 4 * w,
+		Rect:   image.Rect(0, 0, w, h),
+	}
+	return
+}
+
+// DecodeMode decodes data to the pixel layout of mode, for instance BGRA or
+// RGB565 for a framebuffer. The channels of the returned image are the bytes
+// of a pixel, see ColorMode.BytesPerPixel. The image keeps mode, so that
+// Encode reads its pixels back, premultiplied or not. A nil opt means the
+// zero DecodeOptions.
+func DecodeMode(data []byte, mode ColorMode, opt *DecodeOptions) (m *MemPImage, err error) {
+	if !mode.valid() {
+		err = newDecodeError("DecodeMode", VP8StatusInvalidParam)
+		return
+	}
+	w, h, _, err := webpGetInfo(data)
+	if err != nil {
+		return
+	}
+	if err = opt.orDefault().checkSize(w, h); err != nil {
+		return
+	}
+	m = NewMemPImage(image.Rect(0, 0, w, h), mode.BytesPerPixel(), reflect.Uint8)
+	m.mode = mode
+	if err = webpDecodeModeInto(data, opt.decoderOptions(), mode, m.XPix, w, h, m.XStride); err != nil {
+		m = nil
+	}
+	return
+}
+
+// DecodeGrayInto decodes the luma of data into dst, without allocating the
+// pixels. The bounds of dst must have the size of the image, see GetInfo,
+// or an error is returned without touching dst. The size limits of opt do
+// not apply, and a nil opt means the zero DecodeOptions.
+func DecodeGrayInto(dst *image.Gray, data []byte, opt *DecodeOptions) error {
+	b := dst.Rect
+	return webpDecodeGrayInto(data, opt.decoderOptions(), dst.Pix[dst.PixOffset(b.Min.X, b.Min.Y):], b.Dx(), b.Dy(), dst.Stride)
+}
+
+// DecodeRGBInto decodes data into dst, see DecodeGrayInto.
+func DecodeRGBInto(dst *RGBImage, data []byte, opt *DecodeOptions) error {
+	b := dst.XRect
+	return webpDecodeRGBInto(data, opt.decoderOptions(), dst.XPix[dst.PixOffset(b.Min.X, b.Min.Y):], b.Dx(), b.Dy(), dst.XStride)
+}
+
+// DecodeRGBAInto decodes data into dst with premultiplied alpha, see
+// DecodeGrayInto.
+func DecodeRGBAInto(dst *image.RGBA, data []byte, opt *DecodeOptions) error {
+	b := dst.Rect
+	return webpDecodeRGBAInto(data, opt.decoderOptions(), dst.Pix[dst.PixOffset(b.Min.X, b.Min.Y):], b.Dx(), b.Dy(), dst.Stride)
+}
+
+// DecodeNRGBAInto decodes data into dst, see DecodeGrayInto.
+func DecodeNRGBAInto(dst *image.NRGBA, data []byte, opt *DecodeOptions) error {
+	b := dst.Rect
+	return webpDecodeNRGBAInto(data, opt.decoderOptions(), dst.Pix[dst.PixOffset(b.Min.X, b.Min.Y):], b.Dx(), b.Dy(), dst.Stride)
+}
+
+// DecodeRegion decodes the part of data within rect, skipping most of the
+// work for the rest of the image. The region is clipped to the image bounds.
+// If scaledWidth or scaledHeight is not zero, the region is scaled to that
+// size, a zero one following the aspect ratio, and its bounds are scaled
+// accordingly. The returned image has premultiplied
+// alpha, and is positioned at the (scaled) rect.Min. A nil opt means the
+// zero DecodeOptions.
+//
+// libwebp crops lossy images at even coordinates only. Without scaling, an
+// odd rect.Min is handled by decoding one more row or column; with scaling,
+// it is rounded down.
+func DecodeRegion(data []byte, rect image.Rectangle, scaledWidth, scaledHeight int, opt *DecodeOptions) (m *image.RGBA, err error) {
+	opt = opt.orDefault()
+	width, height, _, err := webpGetInfo(data)
+	if err != nil {
+		return
+	}
+	if rect = rect.Intersect(image.Rect(0, 0, width, height)); rect.Empty() {
+		err = newDecodeError("DecodeRegion", VP8StatusInvalidParam)
+		return
+	}
+
+	var crop = rect
+	crop.Min.X, crop.Min.Y = crop.Min.X&^1, crop.Min.Y&^1
+
+	var bounds = crop
+	if scaledWidth != 0 || scaledHeight != 0 {
+		scaledWidth, scaledHeight = scaledSize(crop.Dx(), crop.Dy(), scaledWidth, scaledHeight)
+		if scaledWidth <= 0 || scaledHeight <= 0 {
+			err = newDecodeError("DecodeRegion", VP8StatusInvalidParam)
+			return
+		}
+		min := image.Pt(crop.Min.X*scaledWidth/crop.Dx(), crop.Min.Y*scaledHeight/crop.Dy())
+		bounds = image.Rectangle{min, min.Add(image.Pt(scaledWidth, scaledHeight))}
+		rect = bounds
+	}
+	if err = opt.checkSize(rect.Dx(), rect.Dy()); err != nil {
+		return
+	}
+
+	options := opt.decoderOptions()
+	options.Crop = crop
+	options.ScaledWidth, options.ScaledHeight = scaledWidth, scaledHeight
+
+	m = image.NewRGBA(bounds)
+	if err = webpDecodeRGBAInto(data, options, m.Pix, bounds.Dx(), bounds.Dy(), m.Stride); err != nil {
+		m = nil
+		return
+	}
+	if options.Flip {
+		// The extra row of an odd rect.Min.Y is now at the bottom.
+		m.Rect = m.Rect.Add(image.Pt(0, rect.Min.Y-bounds.Min.Y))
+	}
+	m = m.SubImage(rect).(*image.RGBA)
+	return
+}
+
+// ThumbnailMode selects how DecodeThumbnail fits an image into a box.
+type ThumbnailMode int
+
+const (
+	// ThumbnailFit scales the image to fit inside the box, keeping its
+	// aspect ratio.
+	ThumbnailFit ThumbnailMode = iota
+	// ThumbnailFill scales the image to cover the box, keeping its aspect
+	// ratio, and crops the overflow evenly from both sides. As libwebp crops
+	// lossy images at even coordinates only, the crop is rounded to them,
+	// and may be one pixel off-centre.
+	ThumbnailFill
+	// ThumbnailExact scales the image to the size of the box, ignoring the
+	// aspect ratio.
+	ThumbnailExact
+)
+
+// DecodeThumbnail decodes data scaled into a maxWidth x maxHeight box, with
+// the scaling and cropping done by libwebp in a single pass. A zero maxWidth
+// or maxHeight leaves that dimension unbounded, so it follows the aspect
+// ratio in every mode. The returned image has premultiplied alpha. A nil opt
+// means the zero DecodeOptions.
+func DecodeThumbnail(data []byte, maxWidth, maxHeight int, mode ThumbnailMode, opt *DecodeOptions) (m *image.RGBA, err error) {
+	width, height, _, err := webpGetInfo(data)
+	if err != nil {
+		return
+	}
+	if maxWidth < 0 || maxHeight < 0 || (maxWidth == 0 && maxHeight == 0) {
+		err = newDecodeError("DecodeThumbnail", VP8StatusInvalidParam)
+		return
+	}
+
+	var crop image.Rectangle
+	var scaledWidth, scaledHeight int
+	switch {
+	case mode == ThumbnailExact:
+		scaledWidth, scaledHeight = maxWidth, maxHeight
+	case mode == ThumbnailFill && maxWidth != 0 && maxHeight != 0:
+		// Crop the source to the aspect ratio of the box.
+		cw, ch := width, height
+		if width*maxHeight > height*maxWidth {
+			cw = (maxWidth*height + maxHeight/2) / maxHeight
+		} else {
+			ch = (maxHeight*width + maxWidth/2) / maxWidth
+		}
+		if cw < 1 {
+			cw = 1
+		}
+		if ch < 1 {
+			ch = 1
+		}
+		crop = image.Rect(0, 0, cw, ch).Add(image.Pt((width-cw)/2&^1, (height-ch)/2&^1))
+		scaledWidth, scaledHeight = maxWidth, maxHeight
+	case mode == ThumbnailFit || mode == ThumbnailFill:
+		if maxHeight == 0 || (maxWidth != 0 && width*maxHeight >= height*maxWidth) {
+			scaledWidth = maxWidth
+		} else {
+			scaledHeight = maxHeight
+		}
+	default:
+		err = newDecodeError("DecodeThumbnail", VP8StatusInvalidParam)
+		return
+	}
+
+	if crop.Empty() {
+		scaledWidth, scaledHeight = scaledSize(width, height, scaledWidth, scaledHeight)
+	}
+	if scaledWidth <= 0 || scaledHeight <= 0 {
+		err = newDecodeError("DecodeThumbnail", VP8StatusInvalidParam)
+		return
+	}
+
+	if err = opt.orDefault().checkSize(scaledWidth, scaledHeight); err != nil {
+		return
+	}
+
+	options := opt.decoderOptions()
+	options.Crop = crop
+	options.ScaledWidth, options.ScaledHeight = scaledWidth, scaledHeight
+
+	m = image.NewRGBA(image.Rect(0, 0, scaledWidth, scaledHeight))
+	if err = webpDecodeRGBAInto(data, options, m.Pix, scaledWidth, scaledHeight, m.Stride); err != nil {
+		m = nil
+	}
+	return
+}
+
+// scaledSize returns the size libwebp scales a width x height image to, where
+// a zero scaledWidth or scaledHeight keeps the aspect ratio.
+func scaledSize(width, height, scaledWidth, scaledHeight int) (int, int) {
+	if scaledWidth == 0 {
+		scaledWidth = (width*scaledHeight + height - 1) / height
+	}
+	if scaledHeight == 0 {
+		scaledHeight = (height*scaledWidth + width - 1) / width
+	}
+	return scaledWidth, scaledHeight
+}
+
+// DecodeYCbCr decodes data to its Y'CbCr planes, without any conversion to
+// RGB. It returns an *image.YCbCr with 4:2:0 chroma, or an *image.NYCbCrA if
+// the image has an alpha channel. Lossless images are converted by libwebp.
+// A nil opt means the zero DecodeOptions.
+//
+// The planes are coded in the limited range of BT.601. They are expanded to
+// the full range of JFIF, that image.YCbCr assumes and Encode takes, so that
+// a decoded image can be encoded again without any loss of range.
+func DecodeYCbCr(data []byte, opt *DecodeOptions) (m image.Image, err error) {
+	width, height, hasAlpha, err := webpGetInfo(data)
+	if err != nil {
+		return
+	}
+	if err = opt.orDefault().checkSize(width, height); err != nil {
+		return
+	}
+
+	var rect = image.Rect(0, 0, width, height)
+	if hasAlpha {
+		p := image.NewNYCbCrA(rect, image.YCbCrSubsampleRatio420)
+		if err = webpDecodeYCbCrInto(data, opt.decoderOptions(), &p.YCbCr, p.A, p.AStride); err != nil {
+			return
+		}
+		expandYCbCrRange(&p.YCbCr)
+		m = p
+	} else {
+		p := image.NewYCbCr(rect, image.YCbCrSubsampleRatio420)
+		if err = webpDecodeYCbCrInto(data, opt.decoderOptions(), p, nil, 0); err != nil {
+			return
+		}
+		expandYCbCrRange(p)
+		m = p
+	}
+	return
+}
+
+// The lookup tables from the limited range of BT.601 to the full range of
+// JFIF, the inverse of the ones of the encoder on 16 ~ 235 for luma and
+// 16 ~ 240 for chroma.
+var expandedY, expandedC = func() (y, c [256]uint8) {
+	for i := range y {
+		v := maxInt(i-16, 0) * 255
+		y[i] = uint8(minInt((v+109)/219, 255))
+		c[i] = uint8(minInt((v+112)/224, 255))
+	}
+	return
+}()
+
+// expandYCbCrRange expands the planes of the 4:2:0 image m from the limited
+// range to the full range.
+func expandYCbCrRange(m *image.YCbCr) {
+	w, h := m.Rect.Dx(), m.Rect.Dy()
+	for y := 0; y < h; y++ {
+		row := m.Y[y*m.YStride:][:w]
+		for x, v := range row {
+			row[x] = expandedY[v]
+		}
+	}
+	for y := 0; y < (h+1)/2; y++ {
+		cb, cr := m.Cb[y*m.CStride:][:(w+1)/2], m.Cr[y*m.CStride:][:(w+1)/2]
+		for x := range cb {
+			cb[x], cr[x] = expandedC[cb[x]], expandedC[cr[x]]
+		}
+	}
+}
+
 // DecodeGrayToSize decodes a Gray image scaled to the given dimensions. For
 // large images, the DecodeXXXToSize methods are significantly faster and
 // require less memory compared to decoding a full-size image and then resizing it.
+// They also skip the in-loop filtering and the fancy upsampling of lossy
+// images; use DecodeXXXToSizeWithOptions to keep them.
 func DecodeGrayToSize(data []byte, width, height int) (m *image.Gray, err error) {
-	pix, err := webpDecodeGrayToSize(data, width, height)
+	return DecodeGrayToSizeWithOptions(data, width, height, toSizeDecodeOptions())
+}
+
+// DecodeGrayToSizeWithOptions is like DecodeGrayToSize, but decodes with opt.
+// A nil opt means the zero DecodeOptions.
+func DecodeGrayToSizeWithOptions(data []byte, width, height int, opt *DecodeOptions) (m *image.Gray, err error) {
+	pix, err := webpDecodeGrayToSize(data, width, height, opt)
 	if err != nil {
 		return
 	}
@@ -74,7 +405,13 @@ func DecodeGrayToSize(data []byte, width, height int) (m *image.Gray, err error)
 
 // DecodeRGBToSize decodes an RGB image scaled to the given dimensions.
 func DecodeRGBToSize(data []byte, width, height int) (m *RGBImage, err error) {
-	pix, err := webpDecodeRGBToSize(data, width, height)
+	return DecodeRGBToSizeWithOptions(data, width, height, toSizeDecodeOptions())
+}
+
+// DecodeRGBToSizeWithOptions is like DecodeRGBToSize, but decodes with opt,
+// see DecodeGrayToSizeWithOptions.
+func DecodeRGBToSizeWithOptions(data []byte, width, height int, opt *DecodeOptions) (m *RGBImage, err error) {
+	pix, err := webpDecodeRGBToSize(data, width, height, opt)
 	if err != nil {
 		return
 	}
@@ -86,9 +423,16 @@ func DecodeRGBToSize(data []byte, width, height int) (m *RGBImage, err error) {
 	return
 }
 
-// DecodeRGBAToSize decodes a Gray image scaled to the given dimensions.
+// DecodeRGBAToSize decodes an RGBA image scaled to the given dimensions, with
+// premultiplied alpha.
 func DecodeRGBAToSize(data []byte, width, height int) (m *image.RGBA, err error) {
-	pix, err := webpDecodeRGBAToSize(data, width, height)
+	return DecodeRGBAToSizeWithOptions(data, width, height, toSizeDecodeOptions())
+}
+
+// DecodeRGBAToSizeWithOptions is like DecodeRGBAToSize, but decodes with opt,
+// see DecodeGrayToSizeWithOptions.
+func DecodeRGBAToSizeWithOptions(data []byte, width, height int, opt *DecodeOptions) (m *image.RGBA, err error) {
+	pix, err := webpDecodeRGBAToSize(data, width, height, opt)
 	if err != nil {
 		return
 	}
@@ -100,9 +444,15 @@ func DecodeRGBAToSize(data []byte, width, height int) (m *image.RGBA, err error)
 	return
 }
 
+// toSizeDecodeOptions returns the options of the DecodeXXXToSize functions,
+// trading some quality of lossy images for speed.
+func toSizeDecodeOptions() *DecodeOptions {
+	return &DecodeOptions{BypassFiltering: true, NoFancyUpsampling: true}
+}
+
 func EncodeGray(m image.Image, quality float32) (data []byte, err error) {
 	p := toGrayImage(m)
-	data, err = webpEncodeGray(p.Pix, p.Rect.Dx(), p.Rect.Dy(), p.Stride, quality)
+	data, err = webpEncodeQuality(p.Pix, p.Rect.Dx(), p.Rect.Dy(), p.Stride, 1, quality)
 	if err != nil {
 		return
 	}
@@ -111,57 +461,57 @@ func EncodeGray(m image.Image, quality float32) (data []byte, err error) {
 
 func EncodeRGB(m image.Image, quality float32) (data []byte, err error) {
 	p := NewRGBImageFrom(m)
-	data, err = webpEncodeRGB(p.XPix, p.XRect.Dx(), p.XRect.Dy(), p.XStride, quality)
+	data, err = webpEncodeQuality(p.XPix, p.XRect.Dx(), p.XRect.Dy(), p.XStride, 3, quality)
 	return
 }
 
 func EncodeRGBA(m image.Image, quality float32) (data []byte, err error) {
-	p := toRGBAImage(m)
-	data, err = webpEncodeRGBA(p.Pix, p.Rect.Dx(), p.Rect.Dy(), p.Stride, quality)
+	p := toNRGBAImage(m)
+	data, err = webpEncodeQuality(p.Pix, p.Rect.Dx(), p.Rect.Dy(), p.Stride, 4, quality)
 	return
 }
 
 func EncodeNRGBA(m image.Image, quality float32) (data []byte, err error) {
 	p := toNRGBAImage(m)
-	data, err = webpEncodeRGBA(p.Pix, p.Rect.Dx(), p.Rect.Dy(), p.Stride, quality)
+	data, err = webpEncodeQuality(p.Pix, p.Rect.Dx(), p.Rect.Dy(), p.Stride, 4, quality)
 	return
 }
 
 func EncodeLosslessGray(m image.Image) (data []byte, err error) {
 	p := toGrayImage(m)
-	data, err = webpEncodeLosslessGray(p.Pix, p.Rect.Dx(), p.Rect.Dy(), p.Stride)
+	data, err = webpEncodeLossless(p.Pix, p.Rect.Dx(), p.Rect.Dy(), p.Stride, 1, 70, 0)
 	return
 }
 
 func EncodeLosslessRGB(m image.Image) (data []byte, err error) {
 	p := NewRGBImageFrom(m)
-	data, err = webpEncodeLosslessRGB(p.XPix, p.XRect.Dx(), p.XRect.Dy(), p.XStride)
+	data, err = webpEncodeLossless(p.XPix, p.XRect.Dx(), p.XRect.Dy(), p.XStride, 3, 70, 0)
 	return
 }
 
 func EncodeLosslessRGBA(m image.Image) (data []byte, err error) {
-	p := toRGBAImage(m)
-	data, err = webpEncodeLosslessRGBA(0, p.Pix, p.Rect.Dx(), p.Rect.Dy(), p.Stride)
+	p := toNRGBAImage(m)
+	data, err = webpEncodeLossless(p.Pix, p.Rect.Dx(), p.Rect.Dy(), p.Stride, 4, 100, 0)
 	return
 }
 
 // EncodeExactLosslessRGBA Encode lossless RGB mode with exact.
 // exact: preserve RGB values in transparent area.
 func EncodeExactLosslessRGBA(m image.Image) (data []byte, err error) {
-	p := toRGBAImage(m)
-	data, err = webpEncodeLosslessRGBA(1, p.Pix, p.Rect.Dx(), p.Rect.Dy(), p.Stride)
+	p := toNRGBAImage(m)
+	data, err = webpEncodeLossless(p.Pix, p.Rect.Dx(), p.Rect.Dy(), p.Stride, 4, 100, 1)
 	return
 }
 
 func EncodeLosslessNRGBA(m image.Image) (data []byte, err error) {
 	p := toNRGBAImage(m)
-	data, err = webpEncodeLosslessNRGBA(0, p.Pix, p.Rect.Dx(), p.Rect.Dy(), p.Stride)
+	data, err = webpEncodeLossless(p.Pix, p.Rect.Dx(), p.Rect.Dy(), p.Stride, 4, 100, 0)
 	return
 }
 
 func EncodeExactLosslessNRGBA(m image.Image) (data []byte, err error) {
 	p := toNRGBAImage(m)
-	data, err = webpEncodeLosslessRGBA(1, p.Pix, p.Rect.Dx(), p.Rect.Dy(), p.Stride)
+	data, err = webpEncodeLossless(p.Pix, p.Rect.Dx(), p.Rect.Dy(), p.Stride, 4, 100, 1)
 	return
 }
 
@@ -174,3 +524,129 @@ func GetMetadata(data []byte, format string) (metadata []byte, err error) {
 func SetMetadata(data, metadata []byte, format string) (newData []byte, err error) {
 	return webpSetMetadata(data, metadata, format)
 }
+
+func webpDecodeGray(data []byte, opt *DecodeOptions) (pix []byte, width, height int, err error) {
+	if width, height, _, err = webpGetInfo(data); err != nil {
+		return
+	}
+	if err = opt.orDefault().checkSize(width, height); err != nil {
+		return
+	}
+	pix = make([]byte, width*height)
+	err = webpDecodeGrayInto(data, opt.decoderOptions(), pix, width, height, width)
+	return
+}
+
+func webpDecodeRGB(data []byte, opt *DecodeOptions) (pix []byte, width, height int, err error) {
+	if width, height, _, err = webpGetInfo(data); err != nil {
+		return
+	}
+	if err = opt.orDefault().checkSize(width, height); err != nil {
+		return
+	}
+	pix = make([]byte, width*height*3)
+	err = webpDecodeRGBInto(data, opt.decoderOptions(), pix, width, height, width*3)
+	return
+}
+
+// webpDecodeRGBA decodes premultiplied RGBA pixels.
+func webpDecodeRGBA(data []byte, opt *DecodeOptions) (pix []byte, width, height int, err error) {
+	if width, height, _, err = webpGetInfo(data); err != nil {
+		return
+	}
+	if err = opt.orDefault().checkSize(width, height); err != nil {
+		return
+	}
+	pix = make([]byte, width*height*4)
+	err = webpDecodeRGBAInto(data, opt.decoderOptions(), pix, width, height, width*4)
+	return
+}
+
+// webpDecodeNRGBA decodes non-premultiplied RGBA pixels.
+func webpDecodeNRGBA(data []byte, opt *DecodeOptions) (pix []byte, width, height int, err error) {
+	if width, height, _, err = webpGetInfo(data); err != nil {
+		return
+	}
+	if err = opt.orDefault().checkSize(width, height); err != nil {
+		return
+	}
+	pix = make([]byte, width*height*4)
+	err = webpDecodeNRGBAInto(data, opt.decoderOptions(), pix, width, height, width*4)
+	return
+}
+
+func webpDecodeGrayToSize(data []byte, width, height int, opt *DecodeOptions) (pix []byte, err error) {
+	if width <= 0 || height <= 0 {
+		err = newDecodeError("webpDecodeGrayToSize", VP8StatusInvalidParam)
+		return
+	}
+	if err = opt.orDefault().checkSize(width, height); err != nil {
+		return
+	}
+	pix = make([]byte, width*height)
+	if err = webpDecodeGrayInto(data, scaledOptions(opt, width, height), pix, width, height, width); err != nil {
+		pix = nil
+	}
+	return
+}
+
+func webpDecodeRGBToSize(data []byte, width, height int, opt *DecodeOptions) (pix []byte, err error) {
+	if width <= 0 || height <= 0 {
+		err = newDecodeError("webpDecodeRGBToSize", VP8StatusInvalidParam)
+		return
+	}
+	if err = opt.orDefault().checkSize(width, height); err != nil {
+		return
+	}
+	pix = make([]byte, 3*width*height)
+	if err = webpDecodeRGBInto(data, scaledOptions(opt, width, height), pix, width, height, 3*width); err != nil {
+		pix = nil
+	}
+	return
+}
+
+func webpDecodeRGBAToSize(data []byte, width, height int, opt *DecodeOptions) (pix []byte, err error) {
+	if width <= 0 || height <= 0 {
+		err = newDecodeError("webpDecodeRGBAToSize", VP8StatusInvalidParam)
+		return
+	}
+	if err = opt.orDefault().checkSize(width, height); err != nil {
+		return
+	}
+	pix = make([]byte, 4*width*height)
+	if err = webpDecodeRGBAInto(data, scaledOptions(opt, width, height), pix, width, height, 4*width); err != nil {
+		pix = nil
+	}
+	return
+}
+
+// scaledOptions returns the options of opt, scaling to width x height.
+func scaledOptions(opt *DecodeOptions, width, height int) *webpDecoderOptions {
+	options := opt.decoderOptions()
+	options.ScaledWidth, options.ScaledHeight = width, height
+	return options
+}
+
+// webpEncodeQuality encodes pix like the simple WebPEncodeRGB/RGBA API of
+// libwebp, but reports the encoding error.
+func webpEncodeQuality(pix []byte, width, height, stride, channels int, quality float32) (output []byte, err error) {
+	config := NewWebpConfig()
+	if WebPConfigPreset(config, WebpPresetDefault, quality) == 0 || WebPValidateConfig(config) == 0 {
+		err = newEncodeError("webpEncodeQuality", VP8EncErrorInvalidConfiguration)
+		return
+	}
+	return webpEncodeConfig(config, pix, width, height, stride, channels, nil, nil)
+}
+
+// webpEncodeLossless encodes pix like the simple WebPEncodeLosslessRGB/RGBA
+// API of libwebp, but reports the encoding error.
+func webpEncodeLossless(pix []byte, width, height, stride, channels int, quality float32, exact int) (output []byte, err error) {
+	config := NewWebpConfig()
+	if WebPConfigPreset(config, WebpPresetDefault, quality) == 0 {
+		err = newEncodeError("webpEncodeLossless", VP8EncErrorInvalidConfiguration)
+		return
+	}
+	config.SetLossless(1)
+	config.SetExact(exact)
+	return webpEncodeConfig(config, pix, width, height, stride, channels, nil, nil)
+}
@@ -0,0 +1,159 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gowebp
+
+/*
+#cgo CFLAGS: -I./internal/libwebp-1.3.2/
+#cgo CFLAGS: -I./internal/libwebp-1.3.2/src/
+#cgo CFLAGS: -I./internal/include/
+#cgo CFLAGS: -Wno-pointer-sign -w -DWEBP_USE_THREAD
+
+#include <webp/decode.h>
+
+#include <stdlib.h>
+*/
+import "C"
+import (
+	"image"
+	"runtime"
+	"unsafe"
+)
+
+// IncrementalDecoder decodes a WEBP image as its bytes arrive, so decoding
+// can start before the whole file is available. The data is fed through
+// Write, which makes it usable as the destination of io.Copy.
+type IncrementalDecoder struct {
+	idec   *C.WebPIDecoder
+	config *C.WebPDecoderConfig
+	status C.VP8StatusCode
+}
+
+// NewIncrementalDecoder creates a decoder producing premultiplied RGBA
+// output, with the default options of libwebp. The decoder must be released with
+// Close.
+func NewIncrementalDecoder() (*IncrementalDecoder, error) {
+	return NewIncrementalDecoderWithOptions(nil)
+}
+
+// NewIncrementalDecoderWithOptions is like NewIncrementalDecoder, but tunes
+// the decoder with opt. A nil opt means the zero DecodeOptions. The size
+// limits of opt are not checked, see DecodeContext.
+func NewIncrementalDecoderWithOptions(opt *DecodeOptions) (*IncrementalDecoder, error) {
+	// The decoder keeps pointers into its config, so it must live in C memory.
+	config := (*C.WebPDecoderConfig)(C.calloc(1, C.sizeof_WebPDecoderConfig))
+	if config == nil {
+		return nil, newDecodeError("WebPIDecode", VP8StatusOutOfMemory)
+	}
+	if C.WebPInitDecoderConfigInternal(config, C.WEBP_DECODER_ABI_VERSION) == 0 {
+		C.free(unsafe.Pointer(config))
+		return nil, newDecodeError("WebPIDecode", VP8StatusInvalidParam)
+	}
+	config.options = opt.decoderOptions().toC()
+	config.output.colorspace = C.MODE_rgbA
+
+	idec := C.WebPIDecode(nil, 0, config)
+	if idec == nil {
+		C.free(unsafe.Pointer(config))
+		return nil, newDecodeError("WebPIDecode", VP8StatusOutOfMemory)
+	}
+	d := &IncrementalDecoder{
+		idec:   idec,
+		config: config,
+		status: C.VP8_STATUS_NOT_ENOUGH_DATA,
+	}
+	runtime.SetFinalizer(d, (*IncrementalDecoder).Close)
+	return d, nil
+}
+
+// Write appends p to the data being decoded and decodes as many rows as
+// possible. A nil error only means the data is valid so far; use Done to
+// check whether the image is complete.
+func (d *IncrementalDecoder) Write(p []byte) (n int, err error) {
+	if d.idec == nil {
+		return 0, newDecodeError("IncrementalDecoder", VP8StatusInvalidParam)
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	d.status = C.WebPIAppend(d.idec, (*C.uint8_t)(unsafe.Pointer(&p[0])), C.size_t(len(p)))
+	switch d.status {
+	case C.VP8_STATUS_OK, C.VP8_STATUS_SUSPENDED:
+		return len(p), nil
+	default:
+		return 0, newDecodeError("WebPIAppend", VP8StatusCode(d.status))
+	}
+}
+
+// Done reports whether the whole image has been decoded.
+func (d *IncrementalDecoder) Done() bool {
+	return d.status == C.VP8_STATUS_OK
+}
+
+// NeedMoreData reports whether the data written so far is valid but
+// incomplete.
+func (d *IncrementalDecoder) NeedMoreData() bool {
+	return d.status == C.VP8_STATUS_SUSPENDED || d.status == C.VP8_STATUS_NOT_ENOUGH_DATA
+}
+
+// Image returns a copy of the image decoded so far, together with the
+// number of rows that are available. Rows at and below lastY are left
+// transparent; with the Flip option, the available rows are the last lastY
+// ones instead. It returns a nil image if the header has not been parsed yet.
+func (d *IncrementalDecoder) Image() (m *image.RGBA, lastY int) {
+	if d.idec == nil {
+		return nil, 0
+	}
+
+	var cLastY, cw, ch, cstride C.int
+	var cptr = C.WebPIDecGetRGB(d.idec, &cLastY, &cw, &ch, &cstride)
+	if cptr == nil {
+		return nil, 0
+	}
+
+	w, h, stride := int(cw), int(ch), int(cstride)
+	lastY = int(cLastY)
+	m = image.NewRGBA(image.Rect(0, 0, w, h))
+
+	// A flipped output starts at its last row, with a negative stride.
+	y0, y1 := 0, lastY
+	if stride < 0 {
+		stride = -stride
+		cptr = (*C.uint8_t)(unsafe.Pointer(uintptr(unsafe.Pointer(cptr)) - uintptr((h-1)*stride)))
+		y0, y1 = h-lastY, h
+	}
+	src := ((*[1 << 30]byte)(unsafe.Pointer(cptr)))[0 : h*stride : h*stride]
+	for y := y0; y < y1; y++ {
+		copy(m.Pix[y*m.Stride:][:4*w], src[y*stride:])
+	}
+	runtime.KeepAlive(d) // src is owned by the decoder, freed by its finalizer.
+	return
+}
+
+// Finish returns the decoded image. It returns ErrNeedMoreData if the image
+// is not complete yet.
+func (d *IncrementalDecoder) Finish() (m *image.RGBA, err error) {
+	if !d.Done() {
+		if d.NeedMoreData() {
+			return nil, ErrNeedMoreData
+		}
+		return nil, newDecodeError("IncrementalDecoder", VP8StatusCode(d.status))
+	}
+	m, _ = d.Image()
+	return
+}
+
+// Close releases the memory held by the decoder. It is safe to call Close
+// more than once.
+func (d *IncrementalDecoder) Close() error {
+	if d.idec != nil {
+		C.WebPIDelete(d.idec)
+		C.WebPFreeDecBuffer(&d.config.output)
+		C.free(unsafe.Pointer(d.config))
+		d.idec, d.config = nil, nil
+		runtime.SetFinalizer(d, nil)
+	}
+	return nil
+}
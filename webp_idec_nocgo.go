@@ -0,0 +1,129 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !cgo
+
+package gowebp
+
+import (
+	"encoding/binary"
+	"image"
+)
+
+// IncrementalDecoder decodes a WEBP image as its bytes arrive. The data is
+// fed through Write, which makes it usable as the destination of io.Copy.
+//
+// Without cgo, the data is only checked as it arrives, and the image is
+// decoded once it is complete: Image reports no rows before that.
+type IncrementalDecoder struct {
+	opt    *DecodeOptions
+	data   []byte
+	m      *image.RGBA
+	status VP8StatusCode
+	closed bool
+}
+
+// NewIncrementalDecoder creates a decoder producing premultiplied RGBA
+// output, with the default options of libwebp. The decoder must be released with
+// Close.
+func NewIncrementalDecoder() (*IncrementalDecoder, error) {
+	return NewIncrementalDecoderWithOptions(nil)
+}
+
+// NewIncrementalDecoderWithOptions is like NewIncrementalDecoder, but tunes
+// the decoder with opt. A nil opt means the zero DecodeOptions. The size
+// limits of opt are not checked, see DecodeContext.
+func NewIncrementalDecoderWithOptions(opt *DecodeOptions) (*IncrementalDecoder, error) {
+	o := *opt.orDefault()
+	o.MaxWidth, o.MaxHeight, o.MaxPixels = 0, 0, 0
+	return &IncrementalDecoder{opt: &o, status: VP8StatusNotEnoughData}, nil
+}
+
+// Write appends p to the data being decoded, and decodes the image once it
+// is complete. A nil error only means the data is valid so far; use Done to
+// check whether the image is complete.
+func (d *IncrementalDecoder) Write(p []byte) (n int, err error) {
+	if d.closed {
+		return 0, newDecodeError("IncrementalDecoder", VP8StatusInvalidParam)
+	}
+	if len(p) == 0 || d.status == VP8StatusOk {
+		return len(p), nil
+	}
+
+	d.data = append(d.data, p...)
+	if _, err = riffGetFeatures(d.data); err != nil {
+		if d.status = err.(*Error).Status; d.status != VP8StatusNotEnoughData {
+			d.data = nil
+			return 0, newDecodeError("IncrementalDecoder", d.status)
+		}
+		return len(p), nil
+	}
+	if size := 8 + int(binary.LittleEndian.Uint32(d.data[4:])); len(d.data) < size {
+		d.status = VP8StatusSuspended
+		return len(p), nil
+	}
+
+	pix, width, height, err := webpDecodeRGBA(d.data, d.opt)
+	if err != nil {
+		d.status, d.data = err.(*Error).Status, nil
+		return 0, newDecodeError("IncrementalDecoder", d.status)
+	}
+	d.m = &image.RGBA{Pix: pix, Stride: 4 * width, Rect: image.Rect(0, 0, width, height)}
+	d.status, d.data = VP8StatusOk, nil
+	return len(p), nil
+}
+
+// Done reports whether the whole image has been decoded.
+func (d *IncrementalDecoder) Done() bool {
+	return d.status == VP8StatusOk
+}
+
+// NeedMoreData reports whether the data written so far is valid but
+// incomplete.
+func (d *IncrementalDecoder) NeedMoreData() bool {
+	return d.status == VP8StatusSuspended || d.status == VP8StatusNotEnoughData
+}
+
+// Image returns a copy of the image decoded so far, together with the
+// number of rows that are available. Before the image is complete, it is
+// left transparent and lastY is 0. It returns a nil image if the header has
+// not been parsed yet.
+func (d *IncrementalDecoder) Image() (m *image.RGBA, lastY int) {
+	if d.closed {
+		return nil, 0
+	}
+	if d.m != nil {
+		m = image.NewRGBA(d.m.Rect)
+		copy(m.Pix, d.m.Pix)
+		return m, m.Rect.Dy()
+	}
+	if d.status != VP8StatusSuspended {
+		return nil, 0
+	}
+	width, height, _, err := webpGetInfo(d.data)
+	if err != nil {
+		return nil, 0
+	}
+	return image.NewRGBA(image.Rect(0, 0, width, height)), 0
+}
+
+// Finish returns the decoded image. It returns ErrNeedMoreData if the image
+// is not complete yet.
+func (d *IncrementalDecoder) Finish() (m *image.RGBA, err error) {
+	if !d.Done() {
+		if d.NeedMoreData() {
+			return nil, ErrNeedMoreData
+		}
+		return nil, newDecodeError("IncrementalDecoder", d.status)
+	}
+	m, _ = d.Image()
+	return
+}
+
+// Close releases the memory held by the decoder. It is safe to call Close
+// more than once.
+func (d *IncrementalDecoder) Close() error {
+	d.data, d.m, d.closed = nil, nil, true
+	return nil
+}
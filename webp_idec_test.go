@@ -0,0 +1,64 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gowebp
+
+import (
+	"io/ioutil"
+	"testing"
+)
+
+func TestIncrementalDecoder(t *testing.T) {
+	data, err := ioutil.ReadFile(testdataDir + "video-001.webp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := DecodeRGBA(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := NewIncrementalDecoder()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+
+	const chunkSize = 256
+	for i := 0; i < len(data); i += chunkSize {
+		if _, err := d.Finish(); err != ErrNeedMoreData {
+			t.Fatalf("%d: expect ErrNeedMoreData, got %v", i, err)
+		}
+		end := i + chunkSize
+		if end > len(data) {
+			end = len(data)
+		}
+		if _, err := d.Write(data[i:end]); err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		if m, lastY := d.Image(); m != nil {
+			tAssertEQ(t, want.Bounds(), m.Bounds())
+			tAssertLE(t, lastY, m.Bounds().Dy())
+		}
+	}
+	tAssert(t, d.Done())
+
+	got, err := d.Finish()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tAssertEQ(t, want.Pix, got.Pix)
+}
+
+func TestIncrementalDecoder_corrupt(t *testing.T) {
+	d, err := NewIncrementalDecoder()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+
+	_, err = d.Write([]byte("RIFF\x20\x00\x00\x00WEBPVP8 \x14\x00\x00\x00garbage-garbage-garbage"))
+	tAssertNotNil(t, err)
+	tAssertFalse(t, d.NeedMoreData())
+}
@@ -5,6 +5,10 @@
 package gowebp
 
 import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
 	"io/ioutil"
 	"testing"
 )
@@ -47,3 +51,603 @@ var tGetInfoTesterList = []tGetInfoTester{
 		HasAlpha: true,
 	},
 }
+
+func TestDecodeInto(t *testing.T) {
+	data, err := ioutil.ReadFile(testdataDir + "1_webp_ll.webp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := DecodeNRGBA(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := want.Bounds()
+
+	nrgba := image.NewNRGBA(b)
+	if err := DecodeNRGBAInto(nrgba, data, nil); err != nil {
+		t.Fatal(err)
+	}
+	tAssert(t, bytes.Equal(want.Pix, nrgba.Pix))
+
+	// Decode into a sub-image of a larger buffer.
+	canvas := image.NewRGBA(image.Rect(0, 0, b.Dx()+20, b.Dy()+10))
+	sub := canvas.SubImage(b.Add(image.Pt(10, 5))).(*image.RGBA)
+	if err := DecodeRGBAInto(sub, data, nil); err != nil {
+		t.Fatal(err)
+	}
+	moved := &image.NRGBA{Pix: nrgba.Pix, Stride: nrgba.Stride, Rect: sub.Rect}
+	tAssertLE(t, averageDelta(moved, sub), 1)
+	tAssertEQ(t, color.RGBA{}, canvas.RGBAAt(5, 5))
+
+	gray := image.NewGray(b)
+	if err := DecodeGrayInto(gray, data, nil); err != nil {
+		t.Fatal(err)
+	}
+	rgb := NewRGBImage(b)
+	if err := DecodeRGBInto(rgb, data, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	err = DecodeRGBAInto(image.NewRGBA(image.Rect(0, 0, 10, 10)), data, nil)
+	tAssert(t, errors.Is(err, VP8StatusInvalidParam), err)
+
+	// dst is left untouched on a size mismatch.
+	large := image.NewNRGBA(image.Rect(0, 0, b.Dx()+1, b.Dy()))
+	err = DecodeNRGBAInto(large, data, nil)
+	tAssert(t, errors.Is(err, VP8StatusInvalidParam), err)
+	tAssert(t, bytes.Equal(make([]byte, len(large.Pix)), large.Pix))
+}
+
+func TestDecodeRegion(t *testing.T) {
+	data, err := ioutil.ReadFile(testdataDir + "video-001.webp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	full := image.NewRGBA(image.Rect(0, 0, 150, 103))
+	if err := DecodeRGBAInto(full, data, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	rect := image.Rect(31, 17, 101, 80)
+	m, err := DecodeRegion(data, rect, 0, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tAssertEQ(t, rect, m.Bounds())
+	tAssertLE(t, averageDelta(full.SubImage(rect), m), 1)
+
+	// Clipped to the image.
+	m, err = DecodeRegion(data, image.Rect(100, 50, 200, 200), 0, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tAssertEQ(t, image.Rect(100, 50, 150, 103), m.Bounds())
+
+	m, err = DecodeRegion(data, image.Rect(30, 20, 90, 80), 30, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tAssertEQ(t, image.Rect(15, 10, 45, 40), m.Bounds())
+
+	_, err = DecodeRegion(data, image.Rect(200, 200, 300, 300), 0, 0, nil)
+	tAssert(t, errors.Is(err, VP8StatusInvalidParam), err)
+
+	_, err = DecodeRegion(data, rect, 0, 0, &DecodeOptions{MaxPixels: 100})
+	tAssertEQ(t, ErrImageTooLarge, err)
+}
+
+func TestDecodeThumbnail(t *testing.T) {
+	data, err := ioutil.ReadFile(testdataDir + "video-001.webp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	full, err := DecodeRGBA(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tAssertEQ(t, image.Rect(0, 0, 150, 103), full.Bounds())
+
+	for i, v := range []struct {
+		maxWidth, maxHeight int
+		mode                ThumbnailMode
+		size                image.Point
+	}{
+		{100, 100, ThumbnailFit, image.Pt(100, 69)},
+		{300, 100, ThumbnailFit, image.Pt(146, 100)},
+		{0, 50, ThumbnailFit, image.Pt(73, 50)},
+		{50, 50, ThumbnailFill, image.Pt(50, 50)},
+		{30, 60, ThumbnailFill, image.Pt(30, 60)},
+		{0, 50, ThumbnailFill, image.Pt(73, 50)},
+		{40, 30, ThumbnailExact, image.Pt(40, 30)},
+		{40, 0, ThumbnailExact, image.Pt(40, 28)},
+	} {
+		m, err := DecodeThumbnail(data, v.maxWidth, v.maxHeight, v.mode, nil)
+		if err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		tAssertEQ(t, image.Rectangle{Max: v.size}, m.Bounds(), i)
+
+		// The center of the image stays at the center of the thumbnail.
+		c0 := full.RGBAAt(75, 51)
+		c1 := m.RGBAAt(v.size.X/2, v.size.Y/2)
+		tAssertNear(t, float64(c0.R), float64(c1.R), 24, i)
+		tAssertNear(t, float64(c0.G), float64(c1.G), 24, i)
+		tAssertNear(t, float64(c0.B), float64(c1.B), 24, i)
+	}
+
+	// The crop of ThumbnailFill, centred at 23.5, is rounded to even.
+	m, err := DecodeThumbnail(data, 50, 50, ThumbnailFill, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := DecodeRegion(data, image.Rect(22, 0, 125, 103), 50, 50, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tAssert(t, bytes.Equal(want.Pix, m.Pix))
+
+	_, err = DecodeThumbnail(data, 0, 0, ThumbnailFit, nil)
+	tAssert(t, errors.Is(err, VP8StatusInvalidParam), err)
+	_, err = DecodeThumbnail(data, 10, 10, ThumbnailMode(-1), nil)
+	tAssert(t, errors.Is(err, VP8StatusInvalidParam), err)
+}
+
+func TestDecodeYCbCr(t *testing.T) {
+	for _, name := range []string{
+		"blue-purple-pink",
+		"blue-purple-pink-large.no-filter",
+		"blue-purple-pink-large.simple-filter",
+		"blue-purple-pink-large.normal-filter",
+	} {
+		data, err := ioutil.ReadFile(testdataDir + name + ".lossy.webp")
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		m0, err := DecodeYCbCr(data, nil)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		m, ok := m0.(*image.YCbCr)
+		if !ok {
+			t.Fatalf("%s: got %T, want *image.YCbCr", name, m0)
+		}
+		tAssertEQ(t, image.YCbCrSubsampleRatio420, m.SubsampleRatio, name)
+
+		// The golden image has the Y plane on top, and the Cb and Cr planes
+		// side by side below it, in the limited range.
+		golden, err := loadImage(name + ".lossy.webp.ycbcr.png")
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		g := golden.(*image.Gray)
+		w, h := m.Rect.Dx(), m.Rect.Dy()
+		w2, h2 := (w+1)/2, (h+1)/2
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				tAssertEQ(t, expandedY[g.Pix[y*g.Stride+x]], m.Y[y*m.YStride+x], name, x, y)
+			}
+		}
+		for y := 0; y < h2; y++ {
+			for x := 0; x < w2; x++ {
+				tAssertEQ(t, expandedC[g.Pix[(h+y)*g.Stride+x]], m.Cb[y*m.CStride+x], name, x, y)
+				tAssertEQ(t, expandedC[g.Pix[(h+y)*g.Stride+w2+x]], m.Cr[y*m.CStride+x], name, x, y)
+			}
+		}
+
+		// image.YCbCr gives the colors of libwebp.
+		rgba, err := DecodeRGBA(data)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if got, want := averageDelta(m, rgba), 2; got > want {
+			t.Fatalf("%s: average delta too high; got %d, want <= %d", name, got, want)
+		}
+	}
+}
+
+func TestDecodeYCbCr_range(t *testing.T) {
+	// The expansion is the inverse of the tables of webpEncodeYUVA.
+	for i := 16; i <= 235; i++ {
+		tAssertEQ(t, i, 16+(int(expandedY[i])*219+127)/255, i)
+	}
+	for i := 16; i <= 240; i++ {
+		tAssertEQ(t, i, 16+(int(expandedC[i])*224+127)/255, i)
+	}
+	skipLossy(t)
+
+	// Decoding and encoding again keeps the contrast.
+	data, err := ioutil.ReadFile(testdataDir + "video-001.webp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m0, err := DecodeYCbCr(data, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	contrast := func(m *image.YCbCr) (sum int) {
+		for _, v := range m.Y {
+			sum += absInt(int(v) - 128)
+		}
+		return
+	}
+	m := m0.(*image.YCbCr)
+	for pass := 0; pass < 3; pass++ {
+		buf := new(bytes.Buffer)
+		if err = Encode(buf, m, &Options{Quality: 100}); err != nil {
+			t.Fatal(err)
+		}
+		m1, err := DecodeYCbCr(buf.Bytes(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m = m1.(*image.YCbCr)
+		tAssertNear(t, float64(contrast(m0.(*image.YCbCr))), float64(contrast(m)), float64(contrast(m0.(*image.YCbCr)))/100, pass)
+		if got, want := averageDelta(m0, m), 2; got > want {
+			t.Fatalf("%d: average delta too high; got %d, want <= %d", pass, got, want)
+		}
+	}
+}
+
+func TestDecodeYCbCr_alpha(t *testing.T) {
+	data, err := ioutil.ReadFile(testdataDir + "1_webp_a.webp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m0, err := DecodeYCbCr(data, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, ok := m0.(*image.NYCbCrA)
+	if !ok {
+		t.Fatalf("got %T, want *image.NYCbCrA", m0)
+	}
+
+	rgba, err := DecodeRGBA(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tAssertEQ(t, rgba.Bounds(), m.Bounds())
+	b := m.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if m.A[m.AOffset(x, y)] != rgba.Pix[rgba.PixOffset(x, y)+3] {
+				t.Fatalf("(%d, %d): alpha mismatch", x, y)
+			}
+		}
+	}
+}
+
+func TestDecodeMode(t *testing.T) {
+	data, err := ioutil.ReadFile(testdataDir + "1_webp_a.webp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := DecodeNRGBA(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := want.Bounds()
+
+	for _, mode := range []ColorMode{
+		ColorModeRGB, ColorModeRGBA, ColorModeBGR, ColorModeBGRA, ColorModeARGB,
+		ColorModeRGBA4444, ColorModeRGB565,
+		ColorModergbA, ColorModebgrA, ColorModeArgb, ColorModergbA4444,
+	} {
+		m, err := DecodeMode(data, mode, nil)
+		if err != nil {
+			t.Fatalf("%v: %v", mode, err)
+		}
+		tAssertEQ(t, b, m.Bounds(), mode)
+		tAssertEQ(t, mode.BytesPerPixel(), m.XChannels, mode)
+
+		for y := b.Min.Y; y < b.Max.Y; y += 13 {
+			for x := b.Min.X; x < b.Max.X; x += 13 {
+				c := want.NRGBAAt(x, y)
+				p := color.RGBAModel.Convert(c).(color.RGBA)
+				pix := m.PixelAt(x, y)
+				var got []byte
+				switch mode {
+				case ColorModeRGB:
+					got = []byte{c.R, c.G, c.B}
+				case ColorModeRGBA:
+					got = []byte{c.R, c.G, c.B, c.A}
+				case ColorModeBGR:
+					got = []byte{c.B, c.G, c.R}
+				case ColorModeBGRA:
+					got = []byte{c.B, c.G, c.R, c.A}
+				case ColorModeARGB:
+					got = []byte{c.A, c.R, c.G, c.B}
+				case ColorModergbA, ColorModebgrA, ColorModeArgb:
+					if mode == ColorModebgrA {
+						p.R, p.B = p.B, p.R
+					}
+					if mode == ColorModeArgb {
+						tAssertNear(t, float64(p.A), float64(pix[0]), 0, mode)
+						pix = pix[1:]
+					}
+					// libwebp rounds the premultiplication differently.
+					tAssertNear(t, float64(p.R), float64(pix[0]), 1, mode)
+					tAssertNear(t, float64(p.G), float64(pix[1]), 1, mode)
+					tAssertNear(t, float64(p.B), float64(pix[2]), 1, mode)
+					continue
+				default:
+					continue
+				}
+				tAssertEQ(t, got, pix, mode, x, y)
+			}
+		}
+	}
+
+	_, err = DecodeMode(data, ColorMode(11), nil)
+	tAssert(t, errors.Is(err, VP8StatusInvalidParam), err)
+}
+
+// The images of DecodeMode are encoded with their layout and alpha.
+func TestDecodeMode_encode(t *testing.T) {
+	// Most pixels are semi-transparent.
+	data, err := ioutil.ReadFile(testdataDir + "5_webp_a.webp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := DecodeNRGBA(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The modes without alpha keep the colors of the transparent pixels.
+	opaque := image.NewNRGBA(want.Rect)
+	copy(opaque.Pix, want.Pix)
+	for i := 3; i < len(opaque.Pix); i += 4 {
+		opaque.Pix[i] = 0xff
+	}
+
+	for _, v := range []struct {
+		mode     ColorMode
+		maxDelta int
+	}{
+		{ColorModeRGB, 0},
+		{ColorModeRGBA, 0},
+		{ColorModeBGR, 0},
+		{ColorModeBGRA, 0},
+		{ColorModeARGB, 0},
+		{ColorModeRGBA4444, 8},
+		{ColorModeRGB565, 4},
+		{ColorModergbA, 0},
+		{ColorModebgrA, 0},
+		{ColorModeArgb, 0},
+		{ColorModergbA4444, 8},
+	} {
+		m, err := DecodeMode(data, v.mode, nil)
+		if err != nil {
+			t.Fatalf("%v: %v", v.mode, err)
+		}
+		buf := new(bytes.Buffer)
+		if err = Encode(buf, m, &Options{Lossless: true}); err != nil {
+			t.Fatalf("%v: %v", v.mode, err)
+		}
+		got, err := DecodeNRGBA(buf.Bytes())
+		if err != nil {
+			t.Fatalf("%v: %v", v.mode, err)
+		}
+		if v.mode.BytesPerPixel() == 3 || v.mode == ColorModeRGB565 {
+			tAssertLE(t, averageDelta(opaque, got), v.maxDelta, v.mode)
+		} else {
+			tAssertLE(t, averageDelta(want, got), v.maxDelta, v.mode)
+		}
+	}
+}
+
+func TestDecode_alpha(t *testing.T) {
+	data, err := ioutil.ReadFile(testdataDir + "1_webp_a.webp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	nrgba, ok := m.(*image.NRGBA)
+	if !ok {
+		t.Fatalf("got %T, want *image.NRGBA", m)
+	}
+	rgba, err := DecodeRGBA(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tAssertLE(t, averageDelta(nrgba, rgba), 1)
+
+	config, err := DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tAssertEQ(t, color.NRGBAModel, config.ColorModel)
+
+	data, err = ioutil.ReadFile(testdataDir + "video-001.webp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err = Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, ok = m.(*image.RGBA)
+	tAssert(t, ok, m)
+}
+
+// flipRGBA returns m upside down.
+func flipRGBA(m *image.RGBA) *image.RGBA {
+	b := m.Bounds()
+	p := image.NewRGBA(b)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		copy(p.Pix[p.PixOffset(b.Min.X, b.Max.Y-1-y+b.Min.Y):][:4*b.Dx()], m.Pix[m.PixOffset(b.Min.X, y):])
+	}
+	return p
+}
+
+func TestDecodeOptions(t *testing.T) {
+	data, err := ioutil.ReadFile(testdataDir + "video-001.webp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := DecodeRGBA(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := want.Bounds()
+
+	m, err := DecodeRGBAWithOptions(data, &DecodeOptions{Flip: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tAssertEQ(t, flipRGBA(want).Pix, m.Pix)
+
+	// DefaultDecodeOptions only apply to image.Decode.
+	defer func(opt DecodeOptions) { DefaultDecodeOptions = opt }(DefaultDecodeOptions)
+	DefaultDecodeOptions.Flip = true
+
+	decoded, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tAssertEQ(t, flipRGBA(want).Pix, decoded.(*image.RGBA).Pix)
+	if m, err = DecodeRGBA(data); err != nil {
+		t.Fatal(err)
+	}
+	tAssertEQ(t, want.Pix, m.Pix)
+
+	// The incremental decoder copies the flipped rows it has so far.
+	d, err := NewIncrementalDecoderWithOptions(&DecodeOptions{Flip: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	if _, err = d.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	m, err = d.Finish()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tAssertEQ(t, flipRGBA(want).Pix, m.Pix)
+
+	// An odd rect.Min.Y decodes one more row, which ends up at the bottom.
+	rect := image.Rect(5, 7, 60, 41)
+	region, err := DecodeRegion(data, rect, 0, 0, &DecodeOptions{Flip: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tAssertEQ(t, rect, region.Bounds())
+	wantRegion, err := DecodeRegion(data, rect, 0, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tAssertEQ(t, 0, averageDelta(flipRGBA(wantRegion), region))
+
+	opt := &DecodeOptions{MaxWidth: b.Dx() - 1}
+	DefaultDecodeOptions = *opt
+	if _, _, err = image.Decode(bytes.NewReader(data)); err != ErrImageTooLarge {
+		t.Fatalf("expect ErrImageTooLarge, got %v", err)
+	}
+	if _, err = DecodeGrayToSizeWithOptions(data, b.Dx(), b.Dy(), opt); err != ErrImageTooLarge {
+		t.Fatalf("expect ErrImageTooLarge, got %v", err)
+	}
+	if _, err = DecodeMode(data, ColorModeBGRA, opt); err != ErrImageTooLarge {
+		t.Fatalf("expect ErrImageTooLarge, got %v", err)
+	}
+	if _, err = DecodeAnimation(data, opt); err != ErrImageTooLarge {
+		t.Fatalf("expect ErrImageTooLarge, got %v", err)
+	}
+	if _, err = DecodeGrayToSize(data, b.Dx(), b.Dy()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDecodeToSize_options(t *testing.T) {
+	if !GetCapabilities().DecoderTuning {
+		t.Skip("decoder tuning needs cgo")
+	}
+	data, err := ioutil.ReadFile(testdataDir + "video-001.webp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	width, height, _, err := GetInfo(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// libwebp bypasses the filtering by itself below 3/4 of the size.
+	width, height = width*9/10, height*9/10
+
+	// The DecodeXXXToSize functions skip the filtering and fancy upsampling.
+	m, err := DecodeRGBAToSize(data, width, height)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fast, err := DecodeRGBAToSizeWithOptions(data, width, height, &DecodeOptions{BypassFiltering: true, NoFancyUpsampling: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tAssertEQ(t, fast.Pix, m.Pix)
+	full, err := DecodeRGBAToSizeWithOptions(data, width, height, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tAssertNE(t, full.Pix, m.Pix)
+	tAssertLE(t, averageDelta(full, m), 4)
+
+	gray, err := DecodeGrayToSize(data, width, height)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fastGray, err := DecodeGrayToSizeWithOptions(data, width, height, &DecodeOptions{BypassFiltering: true, NoFancyUpsampling: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tAssertEQ(t, fastGray.Pix, gray.Pix)
+}
+
+func TestDecodeOptions_dithering(t *testing.T) {
+	if !GetCapabilities().DecoderTuning {
+		t.Skip("dithering needs cgo")
+	}
+
+	// libwebp dithers the chroma of images with fine quantizers only.
+	src := image.NewRGBA(image.Rect(0, 0, 128, 128))
+	for y := 0; y < 128; y++ {
+		for x := 0; x < 128; x++ {
+			src.Set(x, y, color.RGBA{uint8(x), uint8(64 + y/2), uint8(128 - x/2), 0xff})
+		}
+	}
+	data, err := EncodeRGB(src, 98)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m0, err := DecodeRGBA(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m1, err := DecodeRGBAWithOptions(data, &DecodeOptions{DitheringStrength: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tAssertNE(t, m0.Pix, m1.Pix)
+
+	for i, v := range []struct {
+		opt     DecodeOptions
+		changed bool
+	}{
+		{DecodeOptions{NoFancyUpsampling: true}, true},
+		{DecodeOptions{UseThreads: true}, false},
+		{DecodeOptions{AlphaDitheringStrength: 100}, false}, // No alpha.
+	} {
+		m, err := DecodeRGBAWithOptions(data, &v.opt)
+		if err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		tAssertEQ(t, m0.Bounds(), m.Bounds(), i)
+		if v.changed {
+			tAssertNE(t, m0.Pix, m.Pix, i)
+		} else {
+			tAssertEQ(t, m0.Pix, m.Pix, i)
+		}
+	}
+}
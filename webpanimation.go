@@ -1,11 +1,16 @@
+//go:build cgo
+
 package gowebp
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"image"
+	"image/color"
 	"image/draw"
 	"io"
+	"runtime"
 )
 
 type WebpAnimation struct {
@@ -16,34 +21,171 @@ type WebpAnimation struct {
 	AnimationEncoder       *WebPAnimEncoder
 	WebPData               *WebPData
 	WebPMux                *WebPMux
-	WebPPictures           []*WebPPicture
+
+	// Deprecated: the pictures are freed as soon as they are added to the
+	// animation encoder, WebPPictures stays empty.
+	WebPPictures []*WebPPicture
 
 	parentImage *image.RGBA
+	closed      bool
+	metadata    []webpMetadata
+
+	// The frames of AddFrameWithOptions are muxed as given, without the
+	// animation encoder, and cannot be mixed with the ones of AddFrame.
+	frameMux       *WebPMux
+	encoderFrame   bool
+	encoderOptions bool // The encoder settings of AnimationOptions are set.
+}
+
+// FrameOptions are the settings of a frame of AddFrameWithOptions.
+type FrameOptions struct {
+	// Duration is the display time of the frame in milliseconds, like the
+	// Delay of a gif.GIF in 1/100 s.
+	Duration int
+	// Offset is the position of the frame on the canvas. It must be even,
+	// as WEBP stores it in units of 2 pixels.
+	Offset image.Point
+	// Blend is how the frame is combined with the canvas.
+	Blend WebPMuxAnimBlend
+	// Dispose is what happens to the area of the frame after its duration.
+	Dispose WebPMuxAnimDispose
+
+	Lossless bool
+	Quality  float32 // 0 ~ 100, 0 selects DefaultQuality.
+}
+
+// AnimationOptions are the settings of NewWebpAnimationWithOptions.
+type AnimationOptions struct {
+	// LoopCount is the number of times the animation is played, 0 looping
+	// forever and 1 playing it once.
+	LoopCount int
+	// BackgroundColor is the canvas background color hint. nil keeps the
+	// default of libwebp, opaque white.
+	BackgroundColor color.Color
+
+	// The fields below map to the WebPAnimEncoderOptions of libwebp. They
+	// only apply to the frames of AddFrame, AddFrameWithOptions fails if one
+	// is set.
+	MinimizeSize bool // Minimize the output size, slower.
+	Kmin, Kmax   int  // Distance between key frames, 0 selects the defaults.
+	AllowMixed   bool // Choose lossy or lossless for each frame.
+
+	// The metadata chunks, stored as is.
+	ICC, EXIF, XMP []byte
+}
+
+// webpMetadata is a metadata chunk of an animation.
+type webpMetadata struct {
+	fourcc string
+	data   []byte
 }
 
 // NewWebpAnimation Initialize animation
 func NewWebpAnimation(width, height, loopCount int) *WebpAnimation {
-	webpAnimation := &WebpAnimation{loopCount: loopCount, Width: width, Height: height}
-	webpAnimation.WebPAnimEncoderOptions = &WebPAnimEncoderOptions{}
+	options := &WebPAnimEncoderOptions{}
+	WebPAnimEncoderOptionsInitInternal(options)
+	return newWebpAnimation(width, height, loopCount, options)
+}
+
+// NewWebpAnimationWithOptions initializes an animation with opts, which are
+// all applied when it is assembled. A nil opts gives the defaults of
+// NewWebpAnimation with a loop count of 0.
+func NewWebpAnimationWithOptions(width, height int, opts *AnimationOptions) (*WebpAnimation, error) {
+	if opts == nil {
+		opts = &AnimationOptions{}
+	}
+	if opts.LoopCount < 0 || opts.LoopCount > 0xffff {
+		return nil, errors.New("webp: NewWebpAnimationWithOptions, loop count out of range")
+	}
+	if opts.Kmin < 0 || opts.Kmax < 0 {
+		return nil, errors.New("webp: NewWebpAnimationWithOptions, negative key frame distance")
+	}
+
+	options := &WebPAnimEncoderOptions{}
+	WebPAnimEncoderOptionsInitInternal(options)
+	params := options.GetAnimParams()
+	params.SetLoopCount(opts.LoopCount)
+	if opts.BackgroundColor != nil {
+		c := color.NRGBAModel.Convert(opts.BackgroundColor).(color.NRGBA)
+		params.SetBgcolor(uint32(c.A)<<24 | uint32(c.R)<<16 | uint32(c.G)<<8 | uint32(c.B))
+	}
+	options.SetAnimParams(params)
+	if opts.MinimizeSize {
+		options.SetMinimizeSize(1)
+	}
+	if opts.Kmin != 0 {
+		options.SetKmin(opts.Kmin)
+	}
+	if opts.Kmax != 0 {
+		options.SetKmax(opts.Kmax)
+	}
+	if opts.AllowMixed {
+		options.SetAllowMixed(1)
+	}
 
-	WebPAnimEncoderOptionsInitInternal(webpAnimation.WebPAnimEncoderOptions)
+	wpa := newWebpAnimation(width, height, opts.LoopCount, options)
+	if wpa.AnimationEncoder == nil {
+		wpa.Close()
+		return nil, errors.New("webp: NewWebpAnimationWithOptions, could not create the animation encoder")
+	}
+	wpa.encoderOptions = opts.MinimizeSize || opts.Kmin != 0 || opts.Kmax != 0 || opts.AllowMixed
+	for _, m := range []webpMetadata{{"ICCP", opts.ICC}, {"EXIF", opts.EXIF}, {"XMP ", opts.XMP}} {
+		if len(m.data) != 0 {
+			wpa.metadata = append(wpa.metadata, m)
+		}
+	}
+	return wpa, nil
+}
 
+// newWebpAnimation creates the animation encoder with options. The C memory
+// is released by a finalizer if Close is not called.
+func newWebpAnimation(width, height, loopCount int, options *WebPAnimEncoderOptions) *WebpAnimation {
+	webpAnimation := &WebpAnimation{loopCount: loopCount, Width: width, Height: height}
+	webpAnimation.WebPAnimEncoderOptions = options
 	webpAnimation.AnimationEncoder = WebPAnimEncoderNewInternal(width, height, webpAnimation.WebPAnimEncoderOptions)
+	runtime.SetFinalizer(webpAnimation, (*WebpAnimation).Close)
 	return webpAnimation
 }
 
-// ReleaseMemory release memory
-func (wpa *WebpAnimation) ReleaseMemory() {
+// Close releases the C memory of the animation, which cannot be used
+// afterwards. It may be called more than once.
+func (wpa *WebpAnimation) Close() error {
+	if wpa.closed {
+		return nil
+	}
+	wpa.closed = true
+	runtime.SetFinalizer(wpa, nil)
+
 	WebPDataClear(wpa.WebPData)
 	WebPMuxDelete(wpa.WebPMux)
+	WebPMuxDelete(wpa.frameMux)
 	for _, webpPicture := range wpa.WebPPictures {
 		WebPPictureFree(webpPicture)
 	}
 	WebPAnimEncoderDelete(wpa.AnimationEncoder)
+	wpa.WebPData, wpa.WebPMux, wpa.frameMux, wpa.AnimationEncoder = nil, nil, nil, nil
+	wpa.WebPPictures, wpa.parentImage = nil, nil
+	return nil
+}
+
+// ReleaseMemory release memory
+//
+// Deprecated: Use Close.
+func (wpa *WebpAnimation) ReleaseMemory() {
+	wpa.Close()
 }
 
-// AddFrame add frame to animation
+// AddFrame add frame to animation. It fails if the animation has frames of
+// AddFrameWithOptions.
 func (wpa *WebpAnimation) AddFrame(img image.Image, timestamp int, webpcfg WebPConfig) error {
+	if wpa.closed {
+		return errors.New("webp: AddFrame, closed animation")
+	}
+	if wpa.frameMux != nil {
+		return errors.New("webp: AddFrame, the animation has frames of AddFrameWithOptions")
+	}
+	wpa.encoderFrame = true
+
 	var webPPicture *WebPPicture = nil
 	var m *image.RGBA
 
@@ -57,7 +199,7 @@ func (wpa *WebpAnimation) AddFrame(img image.Image, timestamp int, webpcfg WebPC
 			var isOpaque = false
 			var hasMask = false
 			if ok {
-				if (palettedImg.Opaque() && b.Min.X == 0 && b.Max.Y == 0 && b.Max.X == wpa.Width && b.Max.Y == wpa.Height) ||
+				if (palettedImg.Opaque() && b.Min.X == 0 && b.Min.Y == 0 && b.Max.X == wpa.Width && b.Max.Y == wpa.Height) ||
 					wpa.parentImage == nil { // if full opaque frame, we create a new image
 					m = image.NewRGBA(image.Rect(0, 0, wpa.Width, wpa.Height))
 					isOpaque = true
@@ -80,55 +222,187 @@ func (wpa *WebpAnimation) AddFrame(img image.Image, timestamp int, webpcfg WebPC
 		}
 
 		webPPicture = &WebPPicture{}
-		wpa.WebPPictures = append(wpa.WebPPictures, webPPicture)
 		webPPicture.SetUseArgb(1)
 		webPPicture.SetHeight(wpa.Height)
 		webPPicture.SetWidth(wpa.Width)
-		err := WebPPictureImportRGBA(m.Pix, m.Stride, webPPicture)
+		// The encoder keeps a copy of the picture, or of its encoding.
+		defer WebPPictureFree(webPPicture)
+		p := toNRGBAImage(m) // libwebp takes straight alpha
+		err := WebPPictureImportRGBA(p.Pix, p.Stride, webPPicture)
 		if err != nil {
 			return err
 		}
 	}
 	res := WebPAnimEncoderAdd(wpa.AnimationEncoder, webPPicture, timestamp, webpcfg)
+	runtime.KeepAlive(wpa) // The finalizer would delete the encoder.
 	if res == 0 {
 		return errors.New("Failed to add frame in animation ecoder")
 	}
 	return nil
 }
 
+// AddFrameWithOptions adds img at opt.Offset on the canvas, for
+// opt.Duration. Unlike AddFrame, the frame is stored as is, with the blend
+// and dispose methods of opt, without the animation encoder. So it fails if
+// the animation has frames of AddFrame, or encoder settings in its
+// AnimationOptions.
+func (wpa *WebpAnimation) AddFrameWithOptions(img image.Image, opt FrameOptions) error {
+	if wpa.closed {
+		return errors.New("webp: AddFrameWithOptions, closed animation")
+	}
+	if wpa.encoderFrame {
+		return errors.New("webp: AddFrameWithOptions, the animation has frames of AddFrame")
+	}
+	if wpa.encoderOptions {
+		return errors.New("webp: AddFrameWithOptions, the encoder settings of AnimationOptions do not apply")
+	}
+	if img == nil {
+		return errors.New("webp: AddFrameWithOptions, nil image")
+	}
+	if opt.Offset.X%2 != 0 || opt.Offset.Y%2 != 0 {
+		return errors.New("webp: AddFrameWithOptions, odd offset")
+	}
+	b := img.Bounds()
+	if r := b.Sub(b.Min).Add(opt.Offset); r.Empty() || !r.In(image.Rect(0, 0, wpa.Width, wpa.Height)) {
+		return errors.New("webp: AddFrameWithOptions, frame outside of the canvas")
+	}
+
+	quality := opt.Quality
+	if quality == 0 {
+		quality = DefaultQuality
+	}
+	var buf bytes.Buffer
+	if err := Encode(&buf, img, &Options{Lossless: opt.Lossless, Quality: quality}); err != nil {
+		return err
+	}
+
+	if wpa.frameMux == nil {
+		if wpa.frameMux = WebPMuxNew(); wpa.frameMux == nil {
+			return errors.New("webp: AddFrameWithOptions, could not create the mux")
+		}
+	}
+	var info WebPMuxFrameInfo
+	info.SetOffset(opt.Offset.X, opt.Offset.Y)
+	info.SetDuration(opt.Duration)
+	info.SetBlendMethod(opt.Blend)
+	info.SetDisposeMethod(opt.Dispose)
+	muxErr := WebPMuxPushFrame(wpa.frameMux, &info, buf.Bytes())
+	runtime.KeepAlive(wpa)
+	if muxErr != WebpMuxOk {
+		return errors.New(fmt.Sprint("webp: AddFrameWithOptions, could not add frame, code:", muxErr))
+	}
+	return nil
+}
+
 // Encode encode animation
 func (wpa *WebpAnimation) Encode(w io.Writer) error {
+	if err := wpa.assemble(); err != nil {
+		return err
+	}
+	_, err := w.Write(wpa.WebPData.GetBytes())
+	runtime.KeepAlive(wpa)
+	return err
+}
+
+// Finish writes the animation to w, without copying it out of the C
+// memory, and closes the animation.
+func (wpa *WebpAnimation) Finish(w io.Writer) error {
+	defer wpa.Close()
+	if err := wpa.assemble(); err != nil {
+		return err
+	}
+	_, err := wpa.WebPData.WriteTo(w)
+	runtime.KeepAlive(wpa) // w reads the C memory of wpa.WebPData.
+	return err
+}
+
+// assemble assembles the animation into wpa.WebPData.
+func (wpa *WebpAnimation) assemble() error {
+	if wpa.closed {
+		return errors.New("webp: Encode, closed animation")
+	}
+	if wpa.frameMux != nil {
+		return wpa.assembleFrames()
+	}
+
+	WebPDataClear(wpa.WebPData)
+	WebPMuxDelete(wpa.WebPMux)
+	wpa.WebPMux = nil
 	wpa.WebPData = &WebPData{}
 
 	WebPDataInit(wpa.WebPData)
 
-	WebPAnimEncoderAssemble(wpa.AnimationEncoder, wpa.WebPData)
+	if WebPAnimEncoderAssemble(wpa.AnimationEncoder, wpa.WebPData) == 0 {
+		return errors.New("webp: Encode, could not assemble the animation")
+	}
 
-	if wpa.loopCount > 0 {
+	if wpa.loopCount > 0 || len(wpa.metadata) != 0 {
 		wpa.WebPMux = WebPMuxCreateInternal(wpa.WebPData, 1)
 		if wpa.WebPMux == nil {
 			return errors.New("ERROR: Could not re-mux to add loop count/metadata.")
 		}
 		WebPDataClear(wpa.WebPData)
 
+		// A single frame is assembled as a still image, without loop count.
 		webPMuxAnimNewParams := WebPMuxAnimParams{}
 		muxErr := WebPMuxGetAnimationParams(wpa.WebPMux, &webPMuxAnimNewParams)
-		if muxErr != WebpMuxOk {
+		if muxErr == WebpMuxOk {
+			webPMuxAnimNewParams.SetLoopCount(wpa.loopCount)
+			muxErr = WebPMuxSetAnimationParams(wpa.WebPMux, &webPMuxAnimNewParams)
+			if muxErr != WebpMuxOk {
+				return errors.New(fmt.Sprint("Could not update loop count, code:", muxErr))
+			}
+		} else if muxErr != WebpMuxNotFound {
 			return errors.New("Could not fetch loop count")
 		}
-		webPMuxAnimNewParams.SetLoopCount(wpa.loopCount)
-
-		muxErr = WebPMuxSetAnimationParams(wpa.WebPMux, &webPMuxAnimNewParams)
-		if muxErr != WebpMuxOk {
-			return errors.New(fmt.Sprint("Could not update loop count, code:", muxErr))
+		if err := wpa.setMetadata(wpa.WebPMux); err != nil {
+			return err
 		}
 
 		muxErr = WebPMuxAssemble(wpa.WebPMux, wpa.WebPData)
+		runtime.KeepAlive(wpa)
 		if muxErr != WebpMuxOk {
 			return errors.New("Could not assemble when re-muxing to add")
 		}
 
 	}
-	_, err := w.Write(wpa.WebPData.GetBytes())
-	return err
+	return nil
+}
+
+// assembleFrames assembles the frames of AddFrameWithOptions.
+func (wpa *WebpAnimation) assembleFrames() error {
+	muxErr := WebPMuxSetCanvasSize(wpa.frameMux, wpa.Width, wpa.Height)
+	if muxErr != WebpMuxOk {
+		return errors.New(fmt.Sprint("webp: Encode, could not set canvas size, code:", muxErr))
+	}
+	params := wpa.WebPAnimEncoderOptions.GetAnimParams()
+	if wpa.loopCount > 0 {
+		params.SetLoopCount(wpa.loopCount)
+	}
+	if muxErr = WebPMuxSetAnimationParams(wpa.frameMux, &params); muxErr != WebpMuxOk {
+		return errors.New(fmt.Sprint("webp: Encode, could not set animation params, code:", muxErr))
+	}
+	if err := wpa.setMetadata(wpa.frameMux); err != nil {
+		return err
+	}
+
+	WebPDataClear(wpa.WebPData)
+	wpa.WebPData = &WebPData{}
+	WebPDataInit(wpa.WebPData)
+	muxErr = WebPMuxAssemble(wpa.frameMux, wpa.WebPData)
+	runtime.KeepAlive(wpa)
+	if muxErr != WebpMuxOk {
+		return errors.New(fmt.Sprint("webp: Encode, could not assemble, code:", muxErr))
+	}
+	return nil
+}
+
+// setMetadata sets the metadata chunks of the animation on mux.
+func (wpa *WebpAnimation) setMetadata(mux *WebPMux) error {
+	for _, m := range wpa.metadata {
+		if muxErr := WebPMuxSetChunk(mux, m.fourcc, m.data); muxErr != WebpMuxOk {
+			return errors.New(fmt.Sprint("webp: Encode, could not set the ", m.fourcc, " chunk, code:", muxErr))
+		}
+	}
+	return nil
 }
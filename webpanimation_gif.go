@@ -0,0 +1,182 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build cgo
+
+package gowebp
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+)
+
+// GIFOptions are the options of FromGIF. They map to the flags of the
+// gif2webp tool of libwebp; the zero value gives its defaults.
+type GIFOptions struct {
+	Lossy        bool    // Encode the frames lossy (-lossy).
+	Mixed        bool    // Choose lossy or lossless for each frame (-mixed).
+	Quality      float32 // 0 ~ 100 (-q), 0 selects the default of 75.
+	Method       int     // 0 ~ 6 (-m), 0 selects the default of 4.
+	MinimizeSize bool    // Minimize the output size, slower (-min_size).
+	Kmin, Kmax   int     // Distance between key frames (-kmin, -kmax), 0 selects the defaults.
+}
+
+// FromGIF converts g to an animated WEBP image, like the gif2webp tool of
+// libwebp. The frames are composited on the canvas with their disposal
+// methods and transparent indexes. The background color hint comes from
+// BackgroundIndex and the delays are converted to milliseconds, those of
+// 10 ms or less being taken as 100 ms as browsers do.
+func FromGIF(g *gif.GIF, opts *GIFOptions) (data []byte, err error) {
+	if opts == nil {
+		opts = &GIFOptions{}
+	}
+	if len(g.Image) == 0 {
+		return nil, errors.New("webp: FromGIF, no frames")
+	}
+	width, height := g.Config.Width, g.Config.Height
+	if width == 0 || height == 0 {
+		var r image.Rectangle
+		for _, m := range g.Image {
+			r = r.Union(m.Rect)
+		}
+		width, height = r.Max.X, r.Max.Y
+	}
+
+	config := NewWebpConfig()
+	quality := opts.Quality
+	if quality == 0 {
+		quality = 75
+	}
+	if WebPConfigPreset(config, WebpPresetDefault, quality) == 0 {
+		return nil, newEncodeError("FromGIF", VP8EncErrorInvalidConfiguration)
+	}
+	lossless := !opts.Lossy && !opts.Mixed
+	if lossless {
+		config.SetLossless(1)
+	}
+	if opts.Method != 0 {
+		config.SetMethod(opts.Method)
+	}
+	if WebPValidateConfig(config) == 0 {
+		return nil, newEncodeError("FromGIF", VP8EncErrorInvalidConfiguration)
+	}
+
+	animOpts := &AnimationOptions{
+		LoopCount:       gifLoopCount(g),
+		BackgroundColor: gifBackgroundColor(g),
+		MinimizeSize:    opts.MinimizeSize,
+		Kmin:            3,
+		Kmax:            5,
+		AllowMixed:      opts.Mixed,
+	}
+	if lossless {
+		animOpts.Kmin, animOpts.Kmax = 9, 17
+	}
+	if opts.Kmin != 0 {
+		animOpts.Kmin = opts.Kmin
+	}
+	if opts.Kmax != 0 {
+		animOpts.Kmax = opts.Kmax
+	}
+
+	anim, err := NewWebpAnimationWithOptions(width, height, animOpts)
+	if err != nil {
+		return nil, err
+	}
+	defer anim.Close()
+
+	// The canvas starts transparent. A disposed frame is cleared to
+	// transparent, or restored from the canvas before it.
+	canvas := image.NewRGBA(image.Rect(0, 0, width, height))
+	previous := image.NewRGBA(canvas.Rect)
+	timestamp := 0
+	for i, m := range g.Image {
+		r := m.Rect.Intersect(canvas.Rect)
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				c := color.NRGBAModel.Convert(m.Palette[m.ColorIndexAt(x, y)]).(color.NRGBA)
+				if c.A != 0 {
+					canvas.SetRGBA(x, y, color.RGBA{c.R, c.G, c.B, 0xff})
+				}
+			}
+		}
+		if err = anim.AddFrame(canvas, timestamp, config); err != nil {
+			return nil, err
+		}
+
+		var disposal byte
+		if i < len(g.Disposal) {
+			disposal = g.Disposal[i]
+		}
+		switch disposal {
+		case gif.DisposalBackground:
+			for y := r.Min.Y; y < r.Max.Y; y++ {
+				row := canvas.Pix[canvas.PixOffset(r.Min.X, y):][:4*r.Dx()]
+				for j := range row {
+					row[j] = 0
+				}
+			}
+		case gif.DisposalPrevious:
+			for y := r.Min.Y; y < r.Max.Y; y++ {
+				copy(canvas.Pix[canvas.PixOffset(r.Min.X, y):][:4*r.Dx()], previous.Pix[previous.PixOffset(r.Min.X, y):])
+			}
+		}
+		copy(previous.Pix, canvas.Pix)
+
+		duration := 0
+		if i < len(g.Delay) {
+			duration = 10 * g.Delay[i]
+		}
+		if duration <= 10 {
+			duration = 100
+		}
+		timestamp += duration
+	}
+	if err = anim.AddFrame(nil, timestamp, config); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err = anim.Finish(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// gifLoopCount returns the WEBP loop count of g. The LoopCount of a GIF is
+// the number of repetitions after the first play, -1 playing once, while
+// WEBP counts the plays. A single frame loops forever.
+func gifLoopCount(g *gif.GIF) int {
+	switch {
+	case len(g.Image) == 1 || g.LoopCount == 0:
+		return 0
+	case g.LoopCount < 0:
+		return 1
+	case g.LoopCount < 65535:
+		return g.LoopCount + 1
+	default:
+		return 65535
+	}
+}
+
+// gifBackgroundColor returns the background color of g. It is transparent
+// if BackgroundIndex is the transparent index of the first frame, and white
+// if it is not in the global palette.
+func gifBackgroundColor(g *gif.GIF) color.NRGBA {
+	index := int(g.BackgroundIndex)
+	if p := g.Image[0].Palette; index < len(p) {
+		if _, _, _, a := p[index].RGBA(); a == 0 {
+			return color.NRGBA{}
+		}
+	}
+	if p, ok := g.Config.ColorModel.(color.Palette); ok && index < len(p) {
+		c := color.NRGBAModel.Convert(p[index]).(color.NRGBA)
+		c.A = 0xff
+		return c
+	}
+	return color.NRGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff}
+}
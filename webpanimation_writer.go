@@ -0,0 +1,283 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build cgo
+
+package gowebp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"io"
+	"runtime"
+)
+
+// WebpAnimationWriter writes an animation to an io.Writer while the frames
+// are added, keeping only the canvas and the last frame in memory, where
+// WebpAnimation holds all the encoded frames until Encode.
+//
+// The RIFF size and the alpha flag of the header are only known by Close.
+// If w is an io.WriteSeeker, the frames are written as they come and Close
+// seeks back to complete the header. Otherwise, as for an HTTP response or
+// a pipe, the encoded frames are buffered and Close writes the animation.
+//
+// Each frame is encoded on its own, as the rectangle of the canvas it
+// changes, and muxed by libwebp, as AddFrameWithOptions does, with
+// WebpMuxNoBlend and WebpMuxDisposeNone. So the output is larger than the
+// one of WebpAnimation.AddFrame, whose encoder also tries key frames,
+// blending and lossy/lossless mixing.
+type WebpAnimationWriter struct {
+	w             io.Writer
+	seeker        io.WriteSeeker // w, if it can seek.
+	buf           *bytes.Buffer  // The animation, if w cannot seek.
+	width, height int
+	loopCount     int
+	start, size   int64 // The offset of the RIFF header in w, and the bytes written since.
+	hasAlpha      bool
+	frames        int
+	ended, closed bool
+
+	canvas    *image.NRGBA // The canvas after the written frames.
+	pending   *image.NRGBA // The last frame, whose duration is not known yet.
+	timestamp int          // The timestamp of pending.
+	config    WebPConfig   // The config of pending.
+	duration  int          // The duration of the last written frame.
+}
+
+// NewWebpAnimationWriter returns a writer of an animation of the given
+// canvas size to w. A loopCount of 0 loops forever.
+func NewWebpAnimationWriter(w io.Writer, width, height, loopCount int) (*WebpAnimationWriter, error) {
+	if width <= 0 || height <= 0 || width > 1<<24 || height > 1<<24 {
+		return nil, errors.New("webp: NewWebpAnimationWriter, invalid canvas size")
+	}
+	if loopCount < 0 || loopCount > 0xffff {
+		return nil, errors.New("webp: NewWebpAnimationWriter, loop count out of range")
+	}
+	aw := &WebpAnimationWriter{
+		w:         w,
+		width:     width,
+		height:    height,
+		loopCount: loopCount,
+		canvas:    image.NewNRGBA(image.Rect(0, 0, width, height)),
+	}
+	if ws, ok := w.(io.WriteSeeker); ok {
+		if start, err := ws.Seek(0, io.SeekCurrent); err == nil {
+			aw.seeker, aw.start = ws, start
+		}
+	}
+	if aw.seeker == nil {
+		aw.buf = new(bytes.Buffer)
+	}
+	return aw, nil
+}
+
+// AddFrame adds img, drawn on a transparent canvas, at timestamp in
+// milliseconds, like WebpAnimation.AddFrame. A nil img sets the end of the
+// last frame. A frame is written when the timestamp of the next one is
+// known, the same frames in a row being merged. A nil webpcfg encodes with
+// DefaultQuality.
+func (aw *WebpAnimationWriter) AddFrame(img image.Image, timestamp int, webpcfg WebPConfig) error {
+	if aw.closed || aw.ended {
+		return errors.New("webp: AddFrame, the animation is finished")
+	}
+	if aw.pending != nil && timestamp <= aw.timestamp {
+		return errors.New("webp: AddFrame, timestamps must increase")
+	}
+	if img == nil {
+		aw.ended = true
+		return aw.flush(timestamp - aw.timestamp)
+	}
+
+	m := image.NewNRGBA(image.Rect(0, 0, aw.width, aw.height))
+	b := img.Bounds()
+	draw.Draw(m, b, img, b.Min, draw.Src)
+	if aw.pending != nil && bytes.Equal(aw.pending.Pix, m.Pix) {
+		return nil
+	}
+	if err := aw.flush(timestamp - aw.timestamp); err != nil {
+		return err
+	}
+	aw.pending, aw.timestamp, aw.config = m, timestamp, webpcfg
+	return nil
+}
+
+// Close writes the pending frame, with the duration of the one before, and
+// completes the header. It does not close the underlying writer. It may be
+// called more than once.
+func (aw *WebpAnimationWriter) Close() error {
+	if aw.closed {
+		return nil
+	}
+	aw.closed = true
+	duration := aw.duration
+	if duration == 0 {
+		duration = 100
+	}
+	if err := aw.flush(duration); err != nil {
+		return err
+	}
+	aw.canvas = nil
+	if aw.frames == 0 {
+		return errors.New("webp: Close, no frames")
+	}
+
+	var size [4]byte
+	binary.LittleEndian.PutUint32(size[:], uint32(aw.size-8))
+	flags := []byte{vp8xFlagAnimation}
+	if aw.hasAlpha {
+		flags[0] |= vp8xFlagAlpha
+	}
+	patches := []struct {
+		off  int64
+		data []byte
+	}{{4, size[:]}, {20, flags}}
+	if aw.seeker == nil {
+		for _, patch := range patches {
+			copy(aw.buf.Bytes()[patch.off:], patch.data)
+		}
+		_, err := aw.buf.WriteTo(aw.w)
+		return err
+	}
+	for _, patch := range patches {
+		if _, err := aw.seeker.Seek(aw.start+patch.off, io.SeekStart); err != nil {
+			return err
+		}
+		if _, err := aw.seeker.Write(patch.data); err != nil {
+			return err
+		}
+	}
+	_, err := aw.seeker.Seek(aw.start+aw.size, io.SeekStart)
+	return err
+}
+
+// flush writes the pending frame, as the rectangle of the canvas it
+// changes, for duration.
+func (aw *WebpAnimationWriter) flush(duration int) error {
+	m := aw.pending
+	if m == nil {
+		return nil
+	}
+	aw.pending = nil
+
+	r := image.Rectangle{}
+	for y := 0; y < aw.height; y++ {
+		row, old := m.Pix[y*m.Stride:][:4*aw.width], aw.canvas.Pix[y*aw.canvas.Stride:][:4*aw.width]
+		if bytes.Equal(row, old) {
+			continue
+		}
+		x0, x1 := 0, aw.width
+		for ; row[4*x0+0] == old[4*x0+0] && row[4*x0+1] == old[4*x0+1] && row[4*x0+2] == old[4*x0+2] && row[4*x0+3] == old[4*x0+3]; x0++ {
+		}
+		for ; row[4*x1-4] == old[4*x1-4] && row[4*x1-3] == old[4*x1-3] && row[4*x1-2] == old[4*x1-2] && row[4*x1-1] == old[4*x1-1]; x1-- {
+		}
+		r = r.Union(image.Rect(x0, y, x1, y+1))
+	}
+	if aw.frames == 0 || r.Empty() {
+		r = m.Rect
+	}
+	// The offsets are stored in units of 2 pixels.
+	r.Min.X &^= 1
+	r.Min.Y &^= 1
+
+	opt := &Options{Config: aw.config}
+	if aw.config == nil {
+		opt.Quality = DefaultQuality
+	}
+	var buf bytes.Buffer
+	if err := Encode(&buf, m.SubImage(r), opt); err != nil {
+		return err
+	}
+	if duration > 0xffffff {
+		duration = 0xffffff
+	}
+	header, anmf, err := aw.mux(buf.Bytes(), r.Min, duration)
+	if err != nil {
+		return err
+	}
+	var data []byte
+	if aw.frames == 0 {
+		// The RIFF size is set by Close.
+		data = append(data, "RIFF\x00\x00\x00\x00WEBP"...)
+		for _, c := range header {
+			data = riffAppendChunk(data, c)
+		}
+	}
+	data = riffAppendChunk(data, anmf)
+	if aw.seeker != nil {
+		_, err = aw.seeker.Write(data)
+	} else {
+		_, err = aw.buf.Write(data)
+	}
+	if err != nil {
+		return err
+	}
+	aw.size += int64(len(data))
+	aw.frames++
+	aw.duration = duration
+	draw.Draw(aw.canvas, r, m, r.Min, draw.Src)
+	return nil
+}
+
+// mux muxes the frame bitstream at offset for duration with libwebp, and
+// returns the VP8X and ANIM chunks of the animation, and the ANMF chunk of
+// the frame.
+func (aw *WebpAnimationWriter) mux(bitstream []byte, offset image.Point, duration int) (header []riffChunk, anmf riffChunk, err error) {
+	mux := WebPMuxNew()
+	if mux == nil {
+		return nil, anmf, errors.New("webp: AddFrame, could not create the mux")
+	}
+	defer WebPMuxDelete(mux)
+
+	muxErr := WebPMuxSetCanvasSize(mux, aw.width, aw.height)
+	if muxErr == WebpMuxOk {
+		var params WebPMuxAnimParams
+		params.SetBgcolor(0xffffffff) // White, as WebpAnimation.
+		params.SetLoopCount(aw.loopCount)
+		muxErr = WebPMuxSetAnimationParams(mux, &params)
+	}
+	var info WebPMuxFrameInfo
+	info.SetOffset(offset.X, offset.Y)
+	info.SetDuration(duration)
+	info.SetBlendMethod(WebpMuxNoBlend)
+	info.SetDisposeMethod(WebpMuxDisposeNone)
+	// A single frame of the canvas size is assembled as a still image, so
+	// the frame is pushed twice, and the first ANMF chunk is kept.
+	for i := 0; i < 2 && muxErr == WebpMuxOk; i++ {
+		muxErr = WebPMuxPushFrame(mux, &info, bitstream)
+	}
+	var data WebPData
+	WebPDataInit(&data)
+	defer WebPDataClear(&data)
+	if muxErr == WebpMuxOk {
+		muxErr = WebPMuxAssemble(mux, &data)
+	}
+	if muxErr != WebpMuxOk {
+		return nil, anmf, errors.New(fmt.Sprint("webp: AddFrame, could not mux the frame, code:", muxErr))
+	}
+
+	chunks, _, err := riffChunks(data.GetBytes())
+	runtime.KeepAlive(&data)
+	if err != nil {
+		return nil, anmf, err
+	}
+	for _, c := range chunks {
+		switch {
+		case c.id == "VP8X" || c.id == "ANIM":
+			header = append(header, riffChunk{c.id, append([]byte(nil), c.data...)})
+		case c.id == "ANMF" && anmf.data == nil:
+			anmf = riffChunk{c.id, append([]byte(nil), c.data...)}
+		}
+	}
+	if len(header) != 2 || anmf.data == nil {
+		return nil, anmf, errors.New("webp: AddFrame, could not mux the frame")
+	}
+	if header[0].data[0]&vp8xFlagAlpha != 0 {
+		aw.hasAlpha = true
+	}
+	return header, anmf, nil
+}
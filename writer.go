@@ -2,11 +2,10 @@
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE file.
 
-//go:build cgo
-
 package gowebp
 
 import (
+	"context"
 	"image"
 	"image/color"
 	"image/draw"
@@ -20,8 +19,102 @@ const DefaultQuality = 90
 // Options are the encoding parameters.
 type Options struct {
 	Lossless bool
-	Quality  float32 // 0 ~ 100
-	Exact    bool    // Preserve RGB values in transparent area.
+	// Quality is 0 ~ 100. Lossless encoding ignores it and keeps the effort
+	// of the EncodeLosslessXXX functions, 70 for Gray and RGB images and 100
+	// for the others; use LosslessLevel to change it.
+	Quality float32
+	Exact   bool // Preserve RGB values in transparent area.
+
+	// Preset selects the libwebp defaults for a class of pictures. It is
+	// applied first, explicit settings below override it.
+	Preset WebPPreset
+	// LosslessLevel, if not nil, 0 ~ 9, replaces Quality and Method by the
+	// libwebp lossless preset of that level (0=fast, 9=slower-better). It
+	// requires Lossless.
+	LosslessLevel *int
+
+	// The fields below map to the WebPConfig fields of libwebp. A zero value
+	// keeps the libwebp default, use Config to set an explicit zero.
+	Method          int     // 0 ~ 6, quality/speed trade-off (0=fast, 6=slower-better).
+	TargetSize      int     // Target size in bytes, enables multi-pass rate control (lossy only).
+	TargetPSNR      float32 // Target PSNR in dB, takes precedence over TargetSize (lossy only).
+	Pass            int     // 1 ~ 10, number of entropy-analysis passes, 6 if a target is set.
+	Segments        int     // 1 ~ 4, maximum number of segments to use.
+	SnsStrength     int     // 0 ~ 100, spatial noise shaping.
+	FilterStrength  int     // 0 ~ 100, loop filter strength.
+	FilterSharpness int     // 0 ~ 7, loop filter sharpness.
+	NearLossless    int     // 0 ~ 100, near lossless preprocessing (100=off).
+	AlphaQuality    int     // 0 ~ 100, quality of the alpha plane.
+	UseSharpYUV     bool    // Use the slower but more accurate RGB to YUV conversion.
+	ThreadLevel     int     // If non-zero, try to use multi-threaded encoding.
+	LowMemory       bool    // Reduce memory usage, at the cost of more CPU.
+
+	// Config, if not nil, is used as is and all the fields above are ignored.
+	Config WebPConfig
+
+	// PureGo selects the pure Go lossless encoder, which builds without cgo
+	// always use, instead of libwebp. Only the Lossless and Exact settings
+	// apply, and lossy encoding fails with VP8EncErrorInvalidConfiguration.
+	PureGo bool
+
+	// Stats, if not nil, receives the statistics of the encoding.
+	Stats *EncodeStats
+
+	// Progress, if not nil, is called with the percent complete, 0 ~ 100.
+	Progress func(percent int)
+}
+
+// EncodeStats reports what the encoder actually achieved, for instance when
+// encoding to a target size or PSNR. It mirrors the WebPAuxStats of libwebp.
+type EncodeStats struct {
+	CodedSize     int        // Final size in bytes.
+	PSNR          [5]float32 // Peak-signal-to-noise ratio for Y/U/V/All/Alpha, in dB.
+	BlockCount    [3]int     // Number of intra4/intra16/skipped macroblocks.
+	HeaderBytes   [2]int     // Approximate number of bytes spent for header and mode-partition #0.
+	ResidualBytes [3][4]int  // Approximate number of bytes spent for DC/AC/uv coefficients for each segment.
+	SegmentSize   [4]int     // Number of macroblocks in each segment.
+	SegmentQuant  [4]int     // Quantizer values for each segment.
+	SegmentLevel  [4]int     // Filtering strength for each segment, 0 ~ 63.
+	AlphaDataSize int        // Size of the transparency data.
+	LayerDataSize int        // Size of the enhancement layer data.
+
+	// Lossless encoder statistics.
+	LosslessFeatures LosslessFeatures // Transforms used by the lossless encoder.
+	HistogramBits    int              // Number of precision bits of histogram.
+	TransformBits    int              // Precision bits for transform.
+	CacheBits        int              // Number of bits for color cache lookup.
+	PaletteSize      int              // Number of colors in palette, if used.
+	LosslessSize     int              // Final lossless size.
+	LosslessHdrSize  int              // Lossless header (transform, huffman etc) size.
+	LosslessDataSize int              // Lossless image data size.
+}
+
+// LosslessFeatures is the set of transforms used by the lossless encoder.
+type LosslessFeatures uint32
+
+const (
+	LosslessPredictor     LosslessFeatures = 1 << iota // Predictor transform.
+	LosslessCrossColor                                 // Cross-color transform.
+	LosslessSubtractGreen                              // Subtract-green transform.
+	LosslessPalette                                    // Color indexing transform.
+)
+
+// encodeProgress is the state of a WebPPicture.progress_hook. The cgo build
+// passes it to C as a cgo.Handle.
+type encodeProgress struct {
+	ctx      context.Context
+	progress func(percent int)
+}
+
+// report returns false to abort the encoding.
+func (p *encodeProgress) report(percent int) bool {
+	if p.ctx.Err() != nil {
+		return false
+	}
+	if p.progress != nil {
+		p.progress(percent)
+	}
+	return true
 }
 
 type colorModeler interface {
@@ -35,80 +128,187 @@ func Save(name string, m image.Image, opt *Options) (err error) {
 	}
 	defer f.Close()
 
-	return encode(f, m, opt)
+	return encode(context.Background(), f, m, opt)
 }
 
 // Encode writes the image m to w in WEBP format.
+//
+// The planes of an *image.YCbCr or *image.NYCbCrA are encoded as is, without
+// going through RGB, unless the encoding is lossless. They are taken in the
+// full range of JFIF, as produced by image/jpeg and DecodeYCbCr.
 func Encode(w io.Writer, m image.Image, opt *Options) (err error) {
-	return encode(w, m, opt)
+	return encode(context.Background(), w, m, opt)
 }
 
-func encode(w io.Writer, m image.Image, opt *Options) (err error) {
-	var output []byte
+// EncodeContext is like Encode, but aborts the encoding and returns
+// ctx.Err() as soon as ctx is done.
+func EncodeContext(ctx context.Context, w io.Writer, m image.Image, opt *Options) (err error) {
+	return encode(ctx, w, m, opt)
+}
 
-	if opt != nil && opt.Lossless {
-		switch m := adjustImage(m).(type) {
-		case *image.Gray:
-			if output, err = EncodeLosslessGray(m); err != nil {
-				return
-			}
-		case *RGBImage:
-			if output, err = EncodeLosslessRGB(m); err != nil {
-				return
-			}
-		case *image.RGBA:
-			if opt.Exact {
-				output, err = EncodeExactLosslessRGBA(m)
-			} else {
-				output, err = EncodeLosslessRGBA(m)
-			}
-			if err != nil {
-				return
-			}
-		case *image.NRGBA:
-			if opt.Exact {
-				output, err = EncodeExactLosslessNRGBA(m)
-			} else {
-				output, err = EncodeLosslessNRGBA(m)
-			}
-			if err != nil {
-				return
+func encode(ctx context.Context, w io.Writer, m image.Image, opt *Options) (err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	m = adjustImage(m)
+	config, err := opt.webpConfig(m)
+	if err != nil {
+		return
+	}
+
+	var stats *EncodeStats
+	var progress *encodeProgress
+	var encodeConfig = webpEncodeConfig
+	if opt != nil {
+		stats = opt.Stats
+		if opt.PureGo {
+			if config.GetLossless() == 0 {
+				return errLossyEncoding("Encode")
 			}
-		default:
-			panic("image/webp: Encode, unreachable!")
+			encodeConfig = goEncodeConfig
 		}
-	} else {
-		quality := float32(DefaultQuality)
-		if opt != nil {
-			quality = opt.Quality
+		if opt.Progress != nil {
+			progress = &encodeProgress{ctx: ctx, progress: opt.Progress}
 		}
+	}
+	if progress == nil && ctx.Done() != nil {
+		progress = &encodeProgress{ctx: ctx}
+	}
 
-		switch m := adjustImage(m).(type) {
-		case *image.Gray:
-			if output, err = EncodeGray(m, quality); err != nil {
-				return
-			}
-		case *RGBImage:
-			if output, err = EncodeRGB(m, quality); err != nil {
-				return
-			}
-		case *image.RGBA:
-			if output, err = EncodeRGBA(m, quality); err != nil {
-				return
-			}
-		case *image.NRGBA:
-			if output, err = EncodeNRGBA(m, quality); err != nil {
-				return
-			}
-		default:
-			panic("image/webp: Encode, unreachable!")
+	var output []byte
+	if config.GetLossless() != 0 {
+		// The planes would be converted back to RGB by libwebp.
+		switch p := m.(type) {
+		case *image.YCbCr:
+			m = NewRGBImageFrom(p)
+		case *image.NYCbCrA:
+			m = toNRGBAImage(p)
 		}
 	}
+	switch m := m.(type) {
+	case *image.Gray:
+		output, err = encodeConfig(config, m.Pix, m.Rect.Dx(), m.Rect.Dy(), m.Stride, 1, stats, progress)
+	case *RGBImage:
+		output, err = encodeConfig(config, m.XPix, m.XRect.Dx(), m.XRect.Dy(), m.XStride, 3, stats, progress)
+	case *image.NRGBA:
+		output, err = encodeConfig(config, m.Pix, m.Rect.Dx(), m.Rect.Dy(), m.Stride, 4, stats, progress)
+	case *image.YCbCr:
+		output, err = webpEncodeYCbCr(config, m, nil, 0, stats, progress)
+	case *image.NYCbCrA:
+		output, err = webpEncodeYCbCr(config, &m.YCbCr, m.A[m.AOffset(m.Rect.Min.X, m.Rect.Min.Y):], m.AStride, stats, progress)
+	default:
+		panic("image/webp: Encode, unreachable!")
+	}
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			err = ctxErr
+		}
+		return
+	}
 	_, err = w.Write(output)
 	return
 }
 
+// webpConfig builds and validates the libwebp encoder configuration
+// described by opt, for the adjusted image m. A nil opt selects lossy
+// encoding at DefaultQuality.
+func (opt *Options) webpConfig(m image.Image) (config WebPConfig, err error) {
+	if opt != nil && opt.Config != nil {
+		config = opt.Config
+	} else {
+		config = NewWebpConfig()
+		if opt == nil {
+			WebPConfigPreset(config, WebpPresetDefault, DefaultQuality)
+		} else if err = opt.applyTo(config, m); err != nil {
+			return
+		}
+	}
+	if WebPValidateConfig(config) == 0 {
+		err = newEncodeError("Encode", VP8EncErrorInvalidConfiguration)
+	}
+	return
+}
+
+func (opt *Options) applyTo(config WebPConfig, m image.Image) error {
+	if opt.Preset < WebpPresetDefault || opt.Preset > WebpPresetText {
+		return newEncodeError("Options.Preset", VP8EncErrorInvalidConfiguration)
+	}
+	quality := opt.Quality
+	if opt.Lossless {
+		quality = losslessQuality(m)
+	}
+	if WebPConfigPreset(config, opt.Preset, quality) == 0 {
+		return newEncodeError("Options.Quality", VP8EncErrorInvalidConfiguration)
+	}
+	if opt.LosslessLevel != nil {
+		if !opt.Lossless || WebPConfigLosslessPreset(config, *opt.LosslessLevel) == 0 {
+			return newEncodeError("Options.LosslessLevel", VP8EncErrorInvalidConfiguration)
+		}
+	}
+	if opt.Lossless {
+		config.SetLossless(1)
+	}
+	if opt.Exact {
+		config.SetExact(1)
+	}
+	if opt.Method != 0 {
+		config.SetMethod(opt.Method)
+	}
+	if opt.TargetSize != 0 {
+		config.SetTargetSize(opt.TargetSize)
+	}
+	if opt.TargetPSNR != 0 {
+		config.SetTargetPSNR(opt.TargetPSNR)
+	}
+	if opt.Pass != 0 {
+		config.SetPass(opt.Pass)
+	} else if opt.TargetSize != 0 || opt.TargetPSNR != 0 {
+		config.SetPass(6)
+	}
+	if opt.Segments != 0 {
+		config.SetSegments(opt.Segments)
+	}
+	if opt.SnsStrength != 0 {
+		config.SetSnsStrength(opt.SnsStrength)
+	}
+	if opt.FilterStrength != 0 {
+		config.SetFilterStrength(opt.FilterStrength)
+	}
+	if opt.FilterSharpness != 0 {
+		config.SetFilterSharpness(opt.FilterSharpness)
+	}
+	if opt.NearLossless != 0 {
+		config.SetNearLossless(opt.NearLossless)
+	}
+	if opt.AlphaQuality != 0 {
+		config.SetAlphaQuality(opt.AlphaQuality)
+	}
+	if opt.UseSharpYUV {
+		config.SetUseSharpYuv(1)
+	}
+	if opt.ThreadLevel != 0 {
+		config.SetThreadLevel(opt.ThreadLevel)
+	}
+	if opt.LowMemory {
+		config.SetLowMemory(1)
+	}
+	return nil
+}
+
+// losslessQuality returns the default lossless effort for the adjusted
+// image m, the one of the EncodeLosslessXXX functions.
+func losslessQuality(m image.Image) float32 {
+	switch m.(type) {
+	case *image.Gray, *RGBImage, *image.YCbCr:
+		return 70
+	}
+	return 100
+}
+
 func adjustImage(m image.Image) image.Image {
+	if p, ok := m.(*MemPImage); ok && p.mode.reordered() {
+		m = p.mode.toNRGBA(p)
+	}
 	if p, ok := AsMemPImage(m); ok {
 		switch {
 		case p.XChannels == 1 && p.XDataType == reflect.Uint8:
@@ -128,10 +328,13 @@ func adjustImage(m image.Image) image.Image {
 		case p.XChannels == 3 && p.XDataType == reflect.Uint16:
 			m = NewRGBImageFrom(m) // MemP is little endian
 		case p.XChannels == 4 && p.XDataType == reflect.Uint8:
-			m = &image.RGBA{
-				Pix:    p.XPix,
-				Stride: p.XStride,
-				Rect:   p.XRect,
+			if _, ok := m.(*image.RGBA); !ok {
+				// The pixels of MemP are passed as is, as straight alpha.
+				m = &image.NRGBA{
+					Pix:    p.XPix,
+					Stride: p.XStride,
+					Rect:   p.XRect,
+				}
 			}
 		case p.XChannels == 4 && p.XDataType == reflect.Uint16:
 			m = toRGBAImage(m) // MemP is little endian
@@ -145,21 +348,23 @@ func adjustImage(m image.Image) image.Image {
 	case *RGB48Image:
 		return NewRGBImageFrom(m)
 	case *image.RGBA:
-		return m
+		return toNRGBAImage(m)
 	case *image.YCbCr:
-		return NewRGBImageFrom(m)
+		return toYCbCr420Image(m)
+	case *image.NYCbCrA:
+		return toNYCbCrA420Image(m)
 
 	case *image.Gray16:
 		return toGrayImage(m)
 	case *image.RGBA64:
-		return toRGBAImage(m)
-	case *image.NRGBA:
 		return toNRGBAImage(m)
+	case *image.NRGBA:
+		return m
 	case *image.NRGBA64:
-		return toRGBAImage(m)
+		return toNRGBAImage(m)
 
 	default:
-		return toRGBAImage(m)
+		return toNRGBAImage(m)
 	}
 }
 
@@ -199,12 +404,70 @@ func toRGBAImage(m image.Image) *image.RGBA {
 	return rgba
 }
 
+// toNRGBAImage returns the pixels of m with straight alpha, as libwebp takes
+// them. Premultiplied images are converted, unless they are opaque.
 func toNRGBAImage(m image.Image) *image.NRGBA {
-	if dst, ok := m.(*image.NRGBA); ok {
-		return dst
+	switch m := m.(type) {
+	case *image.NRGBA:
+		return m
+	case *image.RGBA:
+		if m.Opaque() {
+			return &image.NRGBA{Pix: m.Pix, Stride: m.Stride, Rect: m.Rect}
+		}
 	}
 
 	var dst = image.NewNRGBA(m.Bounds())
 	draw.Draw(dst, m.Bounds(), m, m.Bounds().Min, draw.Src)
 	return dst
 }
+
+// toYCbCr420Image returns m if its chroma is 4:2:0 and aligned on its
+// origin, as libwebp needs it. Otherwise the chroma is resampled to 4:2:0 by
+// averaging the samples of each 2x2 block.
+func toYCbCr420Image(m *image.YCbCr) *image.YCbCr {
+	b := m.Rect
+	if m.SubsampleRatio == image.YCbCrSubsampleRatio420 && b.Min.X%2 == 0 && b.Min.Y%2 == 0 {
+		return m
+	}
+
+	dst := image.NewYCbCr(image.Rect(0, 0, b.Dx(), b.Dy()), image.YCbCrSubsampleRatio420)
+	for y := 0; y < b.Dy(); y++ {
+		copy(dst.Y[y*dst.YStride:][:b.Dx()], m.Y[m.YOffset(b.Min.X, b.Min.Y+y):])
+	}
+	for cy := 0; cy < (b.Dy()+1)/2; cy++ {
+		for cx := 0; cx < (b.Dx()+1)/2; cx++ {
+			var cb, cr, n int
+			for y := b.Min.Y + 2*cy; y < b.Min.Y+2*cy+2 && y < b.Max.Y; y++ {
+				for x := b.Min.X + 2*cx; x < b.Min.X+2*cx+2 && x < b.Max.X; x++ {
+					i := m.COffset(x, y)
+					cb += int(m.Cb[i])
+					cr += int(m.Cr[i])
+					n++
+				}
+			}
+			i := cy*dst.CStride + cx
+			dst.Cb[i] = uint8((cb + n/2) / n)
+			dst.Cr[i] = uint8((cr + n/2) / n)
+		}
+	}
+	return dst
+}
+
+// toNYCbCrA420Image is like toYCbCr420Image, keeping the alpha plane.
+func toNYCbCrA420Image(m *image.NYCbCrA) *image.NYCbCrA {
+	p := toYCbCr420Image(&m.YCbCr)
+	if p == &m.YCbCr {
+		return m
+	}
+
+	b := m.Rect
+	dst := &image.NYCbCrA{
+		YCbCr:   *p,
+		A:       make([]uint8, b.Dx()*b.Dy()),
+		AStride: b.Dx(),
+	}
+	for y := 0; y < b.Dy(); y++ {
+		copy(dst.A[y*dst.AStride:][:b.Dx()], m.A[m.AOffset(b.Min.X, b.Min.Y+y):])
+	}
+	return dst
+}
@@ -6,10 +6,22 @@ package gowebp
 
 import (
 	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/draw"
 	_ "image/png"
 	"testing"
 )
 
+// skipLossy skips a test of lossy encoding in the builds without it, see
+// GetCapabilities.
+func skipLossy(t *testing.T) {
+	if !GetCapabilities().EncodeLossy {
+		t.Skip("lossy encoding needs cgo")
+	}
+}
+
 type tTester struct {
 	Filename string
 	Lossless bool
@@ -64,12 +76,18 @@ var tTesterList = []tTester{
 		Quality:  90,
 		Exact:    false,
 		MaxDelta: 13,
-		MinDelta: 10,
 	},
 }
 
+func tInt(v int) *int {
+	return &v
+}
+
 func TestEncode(t *testing.T) {
 	for i, v := range tTesterList {
+		if !v.Lossless && !GetCapabilities().EncodeLossy {
+			continue
+		}
 		img0, err := loadImage(v.Filename)
 		if err != nil {
 			t.Fatalf("%d: %v", i, err)
@@ -104,3 +122,354 @@ func TestEncode(t *testing.T) {
 		}
 	}
 }
+
+func TestEncode_exact(t *testing.T) {
+	img0, err := loadImage("4_webp_ll.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Without Exact, the RGB under transparent pixels is not kept. It is
+	// hidden in premultiplied space, and only shows with straight alpha.
+	for _, exact := range []bool{true, false} {
+		buf := new(bytes.Buffer)
+		if err := Encode(buf, img0, &Options{Lossless: true, Quality: 90, Exact: exact}); err != nil {
+			t.Fatalf("%v: %v", exact, err)
+		}
+		img1, err := DecodeNRGBA(buf.Bytes())
+		if err != nil {
+			t.Fatalf("%v: %v", exact, err)
+		}
+		tAssertEQ(t, 0, averageDelta(img0, img1), exact)
+		tAssertEQ(t, exact, averageDeltaNRGBA(img0, img1) == 0, exact)
+	}
+}
+
+func TestEncode_options(t *testing.T) {
+	img0, err := loadImage("video-001.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, opt := range []*Options{
+		{Quality: 90, Method: 6, UseSharpYUV: true},
+		{Quality: 90, Segments: 1, SnsStrength: 80, FilterStrength: 20, FilterSharpness: 3},
+		{Quality: 90, ThreadLevel: 1, LowMemory: true},
+		{Lossless: true, Quality: 50, NearLossless: 60},
+		{Quality: 90, Preset: WebpPresetPhoto},
+		{Quality: 90, Preset: WebpPresetDrawing, SnsStrength: 10},
+		{Lossless: true, LosslessLevel: tInt(0)},
+		{Lossless: true, LosslessLevel: tInt(1)},
+		{Lossless: true, LosslessLevel: tInt(9), Method: 3},
+		{Config: NewWebpConfig()},
+	} {
+		if !opt.Lossless && !GetCapabilities().EncodeLossy {
+			continue
+		}
+		buf := new(bytes.Buffer)
+		if err := Encode(buf, img0, opt); err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		img1, err := Decode(buf)
+		if err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		if got, want := averageDelta(img0, img1), 8; got > want {
+			t.Fatalf("%d: average delta too high; got %d, want <= %d", i, got, want)
+		}
+	}
+}
+
+func TestEncode_invalidOptions(t *testing.T) {
+	img0, err := loadImage("video-001.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, opt := range []*Options{
+		{Quality: 90, Method: 7},
+		{Quality: 90, Segments: 5},
+		{Quality: 101},
+		{Quality: 90, Preset: WebPPreset(100)},
+		{Lossless: true, LosslessLevel: tInt(10)},
+		{Lossless: true, LosslessLevel: tInt(-1)},
+		{Quality: 90, LosslessLevel: tInt(5)},
+	} {
+		if err := Encode(new(bytes.Buffer), img0, opt); err == nil {
+			t.Fatalf("%d: expect error, got nil", i)
+		}
+	}
+}
+
+func TestEncode_losslessQuality(t *testing.T) {
+	img0, err := loadImage("video-001.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Lossless encoding keeps the effort of the EncodeLosslessXXX functions,
+	// whatever the Quality.
+	for i, v := range []struct {
+		m      image.Image
+		encode func(image.Image) ([]byte, error)
+	}{
+		{toGrayImage(img0), EncodeLosslessGray},
+		{NewRGBImageFrom(img0), EncodeLosslessRGB},
+		{toNRGBAImage(img0), EncodeLosslessNRGBA},
+	} {
+		want, err := v.encode(v.m)
+		if err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		for _, quality := range []float32{0, 50, 90} {
+			buf := new(bytes.Buffer)
+			if err = Encode(buf, v.m, &Options{Lossless: true, Quality: quality}); err != nil {
+				t.Fatalf("%d: %v", i, err)
+			}
+			tAssert(t, bytes.Equal(want, buf.Bytes()), i, quality)
+		}
+	}
+}
+
+func TestEncode_target(t *testing.T) {
+	skipLossy(t)
+
+	img0, err := loadImage("video-001.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var stats EncodeStats
+	buf := new(bytes.Buffer)
+	if err := Encode(buf, img0, &Options{Quality: 90, TargetSize: 3000, Stats: &stats}); err != nil {
+		t.Fatal(err)
+	}
+	tAssertEQ(t, buf.Len(), stats.CodedSize)
+	tAssertBetween(t, 2400, 3600, float64(stats.CodedSize))
+
+	buf.Reset()
+	if err := Encode(buf, img0, &Options{Quality: 90, TargetPSNR: 35, Stats: &stats}); err != nil {
+		t.Fatal(err)
+	}
+	tAssertEQ(t, buf.Len(), stats.CodedSize)
+	tAssertNear(t, 35, float64(stats.PSNR[3]), 1)
+}
+
+func TestEncode_stats(t *testing.T) {
+	skipLossy(t)
+
+	img0, err := loadImage("video-001.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var stats EncodeStats
+	if err := Encode(new(bytes.Buffer), img0, &Options{Quality: 75, Stats: &stats}); err != nil {
+		t.Fatal(err)
+	}
+	b := img0.Bounds()
+	mbs := ((b.Dx() + 15) / 16) * ((b.Dy() + 15) / 16)
+	tAssertEQ(t, mbs, stats.SegmentSize[0]+stats.SegmentSize[1]+stats.SegmentSize[2]+stats.SegmentSize[3])
+	tAssertEQ(t, mbs, stats.BlockCount[0]+stats.BlockCount[1])
+	tAssert(t, stats.HeaderBytes[0] > 0)
+	tAssertEQ(t, 0, stats.LosslessSize)
+
+	img1, err := loadImage("gopher-doc.8bpp.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Encode(new(bytes.Buffer), img1, &Options{Lossless: true, Stats: &stats}); err != nil {
+		t.Fatal(err)
+	}
+	tAssert(t, stats.LosslessFeatures != 0)
+	tAssertLE(t, 1, stats.PaletteSize)
+	tAssertLE(t, stats.LosslessSize, stats.CodedSize)
+}
+
+func TestEncodeContext(t *testing.T) {
+	img0, err := loadImage("video-001.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var percents []int
+	opt := &Options{Lossless: true, Progress: func(percent int) {
+		percents = append(percents, percent)
+	}}
+	if err := EncodeContext(context.Background(), new(bytes.Buffer), img0, opt); err != nil {
+		t.Fatal(err)
+	}
+	tAssert(t, len(percents) > 1)
+	tAssertEQ(t, 100, percents[len(percents)-1])
+	for i := 1; i < len(percents); i++ {
+		tAssertLE(t, percents[i-1], percents[i])
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	opt.Progress = func(percent int) {
+		if percent > 0 {
+			cancel()
+		}
+	}
+	if err := EncodeContext(ctx, new(bytes.Buffer), img0, opt); err != context.Canceled {
+		t.Fatalf("expect context.Canceled, got %v", err)
+	}
+	if err := EncodeContext(ctx, new(bytes.Buffer), img0, nil); err != context.Canceled {
+		t.Fatalf("expect context.Canceled, got %v", err)
+	}
+}
+
+func newTestYCbCr(m image.Image, ratio image.YCbCrSubsampleRatio) *image.YCbCr {
+	b := m.Bounds()
+	p := image.NewYCbCr(b, ratio)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			r, g, b, _ := m.At(x, y).RGBA()
+			yy, cb, cr := color.RGBToYCbCr(uint8(r>>8), uint8(g>>8), uint8(b>>8))
+			p.Y[p.YOffset(x, y)] = yy
+			// The last pixel of a chroma block wins, it is good enough here.
+			p.Cb[p.COffset(x, y)] = cb
+			p.Cr[p.COffset(x, y)] = cr
+		}
+	}
+	return p
+}
+
+func TestEncode_YCbCr(t *testing.T) {
+	skipLossy(t)
+
+	img0, err := loadImage("video-001.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, ratio := range []image.YCbCrSubsampleRatio{
+		image.YCbCrSubsampleRatio420,
+		image.YCbCrSubsampleRatio444,
+		image.YCbCrSubsampleRatio422,
+		image.YCbCrSubsampleRatio440,
+	} {
+		m := newTestYCbCr(img0, ratio)
+		for j, sub := range []*image.YCbCr{
+			m,
+			m.SubImage(image.Rect(13, 7, 101, 80)).(*image.YCbCr),
+		} {
+			buf := new(bytes.Buffer)
+			if err := Encode(buf, sub, &Options{Quality: 90}); err != nil {
+				t.Fatalf("%d/%d: %v", i, j, err)
+			}
+			img1, err := Decode(buf)
+			if err != nil {
+				t.Fatalf("%d/%d: %v", i, j, err)
+			}
+			tAssertEQ(t, sub.Rect.Size(), img1.Bounds().Size(), i, j)
+
+			moved := &image.YCbCr{
+				Y: sub.Y, Cb: sub.Cb, Cr: sub.Cr,
+				YStride: sub.YStride, CStride: sub.CStride,
+				SubsampleRatio: sub.SubsampleRatio,
+				Rect:           sub.Rect.Sub(sub.Rect.Min),
+			}
+			if got, want := averageDelta(moved, img1), 5; got > want {
+				t.Fatalf("%d/%d: average delta too high; got %d, want <= %d", i, j, got, want)
+			}
+		}
+	}
+}
+
+func TestEncode_NYCbCrA(t *testing.T) {
+	skipLossy(t)
+
+	img0, err := loadImage("video-001.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := img0.Bounds()
+	m := &image.NYCbCrA{
+		YCbCr:   *newTestYCbCr(img0, image.YCbCrSubsampleRatio420),
+		A:       make([]uint8, b.Dx()*b.Dy()),
+		AStride: b.Dx(),
+	}
+	for y := 0; y < b.Dy(); y++ {
+		for x := 0; x < b.Dx(); x++ {
+			m.A[y*m.AStride+x] = uint8(255 * x / b.Dx())
+		}
+	}
+
+	buf := new(bytes.Buffer)
+	if err := Encode(buf, m, &Options{Quality: 90, AlphaQuality: 100}); err != nil {
+		t.Fatal(err)
+	}
+	img1 := image.NewNRGBA(b)
+	if err := DecodeNRGBAInto(img1, buf.Bytes(), nil); err != nil {
+		t.Fatal(err)
+	}
+	for y := 0; y < b.Dy(); y += 7 {
+		for x := 0; x < b.Dx(); x += 7 {
+			tAssertNear(t, float64(m.A[y*m.AStride+x]), float64(img1.NRGBAAt(x, y).A), 2, x, y)
+		}
+	}
+	if got, want := averageDelta(m, img1), 5; got > want {
+		t.Fatalf("average delta too high; got %d, want <= %d", got, want)
+	}
+
+	// Lossless encoding goes through RGB.
+	buf.Reset()
+	if err := Encode(buf, m, &Options{Lossless: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := DecodeNRGBAInto(img1, buf.Bytes(), nil); err != nil {
+		t.Fatal(err)
+	}
+	tAssertEQ(t, color.NRGBAModel.Convert(m.At(40, 30)), img1.At(40, 30))
+}
+
+func TestEncode_premultiplied(t *testing.T) {
+	for _, filename := range []string{"1_webp_ll.png", "2_webp_ll.png", "3_webp_ll.png", "4_webp_ll.png", "5_webp_ll.png"} {
+		img0, err := loadImage(filename)
+		if err != nil {
+			t.Fatalf("%s: %v", filename, err)
+		}
+		b := img0.Bounds()
+		rgba := image.NewRGBA(b)
+		draw.Draw(rgba, b, img0, b.Min, draw.Src)
+		rgba64 := image.NewRGBA64(b)
+		draw.Draw(rgba64, b, img0, b.Min, draw.Src)
+
+		for i, m := range []image.Image{rgba, rgba64} {
+			buf := new(bytes.Buffer)
+			if err := Encode(buf, m, &Options{Lossless: true}); err != nil {
+				t.Fatalf("%s/%d: %v", filename, i, err)
+			}
+			img1, err := Decode(buf)
+			if err != nil {
+				t.Fatalf("%s/%d: %v", filename, i, err)
+			}
+			if got, want := averageDelta(img0, img1), 0; got > want {
+				t.Fatalf("%s/%d: average delta too high; got %d, want <= %d", filename, i, got, want)
+			}
+		}
+
+		for i, encode := range []func(image.Image) ([]byte, error){
+			EncodeLosslessRGBA,
+			EncodeExactLosslessRGBA,
+			func(m image.Image) ([]byte, error) { return EncodeRGBA(m, 90) },
+		} {
+			if i == 2 && !GetCapabilities().EncodeLossy {
+				continue
+			}
+			data, err := encode(rgba)
+			if err != nil {
+				t.Fatalf("%s/%d: %v", filename, i, err)
+			}
+			img1, err := DecodeRGBA(data)
+			if err != nil {
+				t.Fatalf("%s/%d: %v", filename, i, err)
+			}
+			if got, want := averageDelta(rgba, img1), 5; got > want {
+				t.Fatalf("%s/%d: average delta too high; got %d, want <= %d", filename, i, got, want)
+			}
+		}
+	}
+}